@@ -0,0 +1,90 @@
+package gorbl
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+LookupBatch looks up each of the supplied IPs in the RBL, returning one RBLResults per IP
+in the order they were supplied. The IPs are looked up sequentially unless a concurrency
+limit is configured (see WithMaxConcurrency), in which case up to that many run at once.
+
+If jitter is configured (see WithJitter), a random delay is inserted between queries to
+avoid sending synchronized bursts at the RBL provider.
+*/
+func (r *RBL) LookupBatch(ctx context.Context, ips []net.IP) []RBLResults {
+	ctx, cancel := r.budgetContext(ctx)
+	defer cancel()
+
+	ret := make([]RBLResults, len(ips))
+
+	workers := r.maxConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	slots := make(chan struct{}, workers)
+
+	var wg sync.WaitGroup
+
+	for i, ip := range ips {
+		if i > 0 {
+			r.wait(ctx, r.jitterDelay())
+		}
+
+		slots <- struct{}{}
+
+		if r.budget > 0 && ctx.Err() != nil {
+			<-slots
+
+			incomplete := r.newResults(ip.String())
+			incomplete.Incomplete = true
+
+			ret[i] = incomplete
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, ip net.IP) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			ret[i] = r.LookupIP(ctx, ip)
+
+			// The budget may also expire during a lookup, leaving its results failed.
+			if r.budget > 0 && ctx.Err() != nil {
+				ret[i].Incomplete = true
+			}
+		}(i, ip)
+	}
+
+	wg.Wait()
+	return ret
+}
+
+// jitterDelay returns a random delay in [0, jitter), or 0 if no jitter is configured.
+func (r *RBL) jitterDelay() time.Duration {
+	if r.jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(r.jitter)))
+}
+
+// wait blocks for the supplied delay, returning early if the context is done.
+func (r *RBL) wait(ctx context.Context, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
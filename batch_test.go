@@ -0,0 +1,125 @@
+package gorbl
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestJitterDelay(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("b.barracudacentral.org", false)
+
+	if d := rbl.jitterDelay(); d != 0 {
+		t.Errorf("Expected no jitter by default, actual %s", d)
+	}
+
+	rbl = NewRBL("b.barracudacentral.org", false, WithJitter(time.Millisecond*50))
+
+	for i := 0; i < 100; i++ {
+		if d := rbl.jitterDelay(); d < 0 || d >= time.Millisecond*50 {
+			t.Fatalf("Expected jitter in [0, 50ms), actual %s", d)
+		}
+	}
+}
+
+func TestLookupBatchParams(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithJitter(time.Millisecond))
+
+	ips := []net.IP{net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3"), net.ParseIP("192.0.2.1")}
+	res := rbl.LookupBatch(context.Background(), ips)
+
+	if len(res) != len(ips) {
+		t.Fatalf("Expected %d results, actual %d", len(ips), len(res))
+	}
+
+	listed := []bool{true, false, false}
+	for i, ip := range ips {
+		if res[i].Host != ip.String() {
+			t.Errorf("Expected %s, actual %s", ip, res[i].Host)
+		}
+
+		if len(res[i].Results) != 1 || res[i].Results[0].Address != ip.String() || res[i].IsListed() != listed[i] {
+			t.Errorf("Expected %s listed %t, actual %+v", ip, listed[i], res[i].Results)
+		}
+	}
+
+	expected := []string{"2.0.0.127.dnsbl.example.org.", "3.0.0.127.dnsbl.example.org.", "1.2.0.192.dnsbl.example.org."}
+	if !reflect.DeepEqual(mock.hostQueries, expected) {
+		t.Errorf("Expected queries %v in order, actual %v", expected, mock.hostQueries)
+	}
+}
+
+func TestLookupBatchQueriedName(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.b.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithSubZones("a", "b"))
+
+	ips := []net.IP{net.ParseIP("127.0.0.2"), net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}
+	res := rbl.LookupBatch(context.Background(), ips)
+
+	expected := [][]string{
+		{"2.0.0.127.a.dnsbl.example.org.", "2.0.0.127.b.dnsbl.example.org."},
+		{"1.2.0.192.a.dnsbl.example.org.", "1.2.0.192.b.dnsbl.example.org."},
+		{ReverseIPv6(ips[2]) + ".a.dnsbl.example.org.", ReverseIPv6(ips[2]) + ".b.dnsbl.example.org."},
+	}
+
+	for i, rr := range res {
+		if len(rr.Results) != len(expected[i]) {
+			t.Fatalf("Expected %d results for %s, actual %+v", len(expected[i]), ips[i], rr.Results)
+		}
+
+		for j, r := range rr.Results {
+			if r.QueriedName != expected[i][j] {
+				t.Errorf("Expected %s, actual %s", expected[i][j], r.QueriedName)
+			}
+		}
+	}
+}
+
+func TestLookupBatchMaxConcurrency(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{delay: time.Millisecond * 20}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithLimiter(NewLimiter(10)), WithMaxConcurrency(2))
+
+	ips := make([]net.IP, 8)
+	for i := range ips {
+		ips[i] = net.IPv4(192, 0, 2, byte(i+1))
+	}
+
+	res := rbl.LookupBatch(context.Background(), ips)
+	for i, ip := range ips {
+		if res[i].Host != ip.String() {
+			t.Errorf("Expected %s, actual %s", ip, res[i].Host)
+		}
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	// The list's own limit applies even though the shared limiter has spare capacity.
+	if mock.maxInFlight != 2 {
+		t.Errorf("Expected 2 queries in flight at most, actual %d", mock.maxInFlight)
+	}
+}
+
+func TestLookupBatchBudgetExpiresDuringLookup(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{delay: time.Millisecond * 200}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithBudget(time.Millisecond*20))
+
+	res := rbl.LookupBatch(context.Background(), []net.IP{net.IPv4(192, 0, 2, 1)})
+
+	if len(res) != 1 || !res[0].Incomplete {
+		t.Fatalf("Expected the results to be marked incomplete, actual %+v", res)
+	}
+
+	if len(res[0].Results) != 1 || !res[0].Results[0].Failed() {
+		t.Errorf("Expected the interrupted lookup to fail, actual %+v", res[0].Results)
+	}
+}
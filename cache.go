@@ -0,0 +1,203 @@
+package gorbl
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+/*
+CacheStats reports the activity of an RBL's result cache (see WithCache).
+*/
+type CacheStats struct {
+	// Entries is the number of queries currently cached
+	Entries int `json:"entries"`
+	// Hits is the number of queries answered from the cache
+	Hits uint64 `json:"hits"`
+	// Misses is the number of queries not found in the cache (including expired entries)
+	Misses uint64 `json:"misses"`
+	// Evictions is the number of entries evicted to respect the maximum entry count
+	Evictions uint64 `json:"evictions"`
+}
+
+// cacheEntry is a single cached query, keyed by its full query name (which includes the list's zone).
+type cacheEntry struct {
+	name    string
+	results []Result
+	expires time.Time
+}
+
+/*
+resultCache caches the results of each query for a TTL depending on whether they report a
+listing, optionally bounding the number of entries by evicting the least recently used.
+*/
+type resultCache struct {
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+	// stale is how long past their TTL entries are still served while being refreshed.
+	stale time.Duration
+	// now returns the current time, allowing tests to control expiry.
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order holds the entries from most to least recently used.
+	order *list.List
+	stats CacheStats
+	// refreshing holds the names of stale entries being refreshed.
+	refreshing map[string]bool
+}
+
+/*
+newResultCache creates a cache holding listings for positiveTTL and other results for
+negativeTTL, with at most maxEntries entries if positive. Expired entries are served for up
+to stale beyond their TTL while being refreshed.
+*/
+func newResultCache(positiveTTL time.Duration, negativeTTL time.Duration, maxEntries int, stale time.Duration) *resultCache {
+	return &resultCache{
+		positiveTTL: positiveTTL,
+		negativeTTL: negativeTTL,
+		maxEntries:  maxEntries,
+		stale:       stale,
+		now:         time.Now,
+		entries:     map[string]*list.Element{},
+		order:       list.New(),
+		refreshing:  map[string]bool{},
+	}
+}
+
+/*
+get returns a copy of the results cached for the supplied query name, marked FromCache, if
+present and within the stale window. The second return value is true if the results have
+expired and the caller should refresh them (see startRefresh).
+*/
+func (c *resultCache) get(name string) ([]Result, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[name]
+	if !ok {
+		c.stats.Misses++
+		return nil, false, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	now := c.now()
+	if now.After(entry.expires.Add(c.stale)) {
+		c.remove(elem)
+		c.stats.Misses++
+		return nil, false, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.stats.Hits++
+
+	results := append([]Result(nil), entry.results...)
+	for i := range results {
+		results[i].FromCache = true
+	}
+
+	return results, now.After(entry.expires), true
+}
+
+// startRefresh returns true if the caller should refresh the supplied name, ensuring only one refresh of a name runs at once.
+func (c *resultCache) startRefresh(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refreshing[name] {
+		return false
+	}
+
+	c.refreshing[name] = true
+	return true
+}
+
+// endRefresh records the refresh of the supplied name has completed.
+func (c *resultCache) endRefresh(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.refreshing, name)
+}
+
+/*
+put caches the supplied results for the query name, evicting the least recently used entries
+if full. Nothing is cached if the TTL applying to the results isn't positive.
+*/
+func (c *resultCache) put(name string, results []Result) {
+	ttl := c.negativeTTL
+	for _, res := range results {
+		if res.Listed {
+			ttl = c.positiveTTL
+			break
+		}
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{
+		name:    name,
+		results: append([]Result(nil), results...),
+		expires: c.now().Add(ttl),
+	}
+
+	if elem, ok := c.entries[name]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[name] = c.order.PushFront(entry)
+
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove drops the supplied entry; the caller must hold the lock.
+func (c *resultCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).name)
+}
+
+// snapshot returns the current statistics.
+func (c *resultCache) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// cacheTTLs returns the TTLs applying to listings and other results, defaulting to the WithCache TTL.
+func (r *RBL) cacheTTLs() (positive time.Duration, negative time.Duration) {
+	positive, negative = r.cacheTTL, r.cacheTTL
+
+	if r.positiveTTL > 0 {
+		positive = r.positiveTTL
+	}
+
+	if r.negativeTTL > 0 {
+		negative = r.negativeTTL
+	}
+
+	return positive, negative
+}
+
+// CacheStats returns the activity of the RBL's result cache; the zero value is returned if caching isn't enabled.
+func (r *RBL) CacheStats() CacheStats {
+	if r.cache == nil {
+		return CacheStats{}
+	}
+
+	return r.cache.snapshot()
+}
@@ -0,0 +1,289 @@
+package gorbl
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestCacheAnswersRepeatedLookups(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithCache(time.Minute))
+
+	for i := 0; i < 3; i++ {
+		if res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")); !res.IsListed() {
+			t.Errorf("Expected a listing, actual %+v", res.Results)
+		}
+	}
+
+	if c := mock.hostQueryCount(); c != 1 {
+		t.Errorf("Expected a single query, actual %d", c)
+	}
+
+	stats := rbl.CacheStats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, actual %+v", stats)
+	}
+}
+
+func TestCacheFromCache(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithCache(time.Minute))
+
+	first := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(first.Results) != 1 || first.Results[0].FromCache {
+		t.Errorf("Expected a freshly queried result, actual %+v", first.Results)
+	}
+
+	second := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(second.Results) != 1 || !second.Results[0].FromCache {
+		t.Errorf("Expected a result served from cache, actual %+v", second.Results)
+	}
+
+	uncached := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+	for i := 0; i < 2; i++ {
+		if res := uncached.LookupIP(context.Background(), net.ParseIP("127.0.0.2")); len(res.Results) != 1 || res.Results[0].FromCache {
+			t.Errorf("Expected results without a cache to be freshly queried, actual %+v", res.Results)
+		}
+	}
+}
+
+func TestCacheExpiresAndSkipsFailures(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{errs: map[string]error{"1.2.0.192.dnsbl.example.org.": &net.DNSError{Err: "server misbehaving", IsTemporary: true}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithCache(time.Millisecond*20))
+
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if c := mock.hostQueryCount(); c != 2 {
+		t.Errorf("Expected failures not to be cached, actual %d queries", c)
+	}
+
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.2"))
+	time.Sleep(time.Millisecond * 40)
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.2"))
+	if c := mock.hostQueryCount(); c != 4 {
+		t.Errorf("Expected the expired entry to be queried again, actual %d queries", c)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithCache(time.Minute), WithMaxCacheEntries(2))
+
+	lookup := func(ip string) {
+		rbl.LookupIP(context.Background(), net.ParseIP(ip))
+	}
+
+	lookup("192.0.2.1")
+	lookup("192.0.2.2")
+	lookup("192.0.2.1") // 192.0.2.2 is now the least recently used.
+	lookup("192.0.2.3")
+
+	stats := rbl.CacheStats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("Expected 2 entries and 1 eviction, actual %+v", stats)
+	}
+
+	before := mock.hostQueryCount()
+	lookup("192.0.2.1")
+	lookup("192.0.2.3")
+	if c := mock.hostQueryCount(); c != before {
+		t.Errorf("Expected the recently used entries to remain cached, actual %d new queries", c-before)
+	}
+
+	lookup("192.0.2.2")
+	if c := mock.hostQueryCount(); c != before+1 {
+		t.Errorf("Expected the least recently used entry to be evicted, actual %d new queries", c-before)
+	}
+}
+
+func TestCacheSeparateTTLs(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithCache(time.Minute), WithPositiveTTL(time.Millisecond*20))
+
+	listed, clean := net.ParseIP("127.0.0.2"), net.ParseIP("192.0.2.1")
+
+	rbl.LookupIP(context.Background(), listed)
+	rbl.LookupIP(context.Background(), clean)
+	time.Sleep(time.Millisecond * 40)
+	rbl.LookupIP(context.Background(), listed)
+	rbl.LookupIP(context.Background(), clean)
+
+	// Only the listing expired.
+	if c := mock.hostQueryCount(); c != 3 {
+		t.Errorf("Expected the listing alone to be queried again, actual %d queries", c)
+	}
+
+	// Negative caching alone leaves listings uncached.
+	mock = &mockResolver{hosts: mock.hosts}
+	rbl = NewRBL("dnsbl.example.org", false, WithResolver(mock), WithNegativeTTL(time.Minute))
+
+	for i := 0; i < 2; i++ {
+		rbl.LookupIP(context.Background(), listed)
+		rbl.LookupIP(context.Background(), clean)
+	}
+
+	if c := mock.hostQueryCount(); c != 3 {
+		t.Errorf("Expected only the clean result to be cached, actual %d queries", c)
+	}
+}
+
+func TestCacheKeyIncludesZone(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{
+		"2.0.0.127.dnsbl.example.org.":        {"127.0.0.2"},
+		"2.0.0.127.zen.dnsbl.example.org.":    {"127.0.0.4"},
+		"2.0.0.127.dnsbl.example.net.":        {"127.0.0.3"},
+		"2.0.0.127.policy.dnsbl.example.org.": {"127.0.0.10"},
+	}}
+
+	first := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithCache(time.Minute))
+	second := NewRBL("dnsbl.example.net", false, WithResolver(mock), WithCache(time.Minute))
+	m := NewMultiRBL([]Lookuper{first, second})
+
+	for i := 0; i < 2; i++ {
+		rets := m.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+		if len(rets) != 2 || rets[0].Results[0].ListedAddress != "127.0.0.2" || rets[1].Results[0].ListedAddress != "127.0.0.3" {
+			t.Errorf("Expected each list's own answer, actual %+v", rets)
+		}
+	}
+
+	if c := mock.hostQueryCount(); c != 2 {
+		t.Errorf("Expected a single query per list, actual %d", c)
+	}
+
+	// Zones beneath the same list are cached separately too.
+	zoned := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithCache(time.Minute), WithSubZones("zen", "policy"))
+	for i := 0; i < 2; i++ {
+		res := zoned.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+		if len(res.Results) != 2 || res.Results[0].ListedAddress != "127.0.0.4" || res.Results[1].ListedAddress != "127.0.0.10" {
+			t.Errorf("Expected each zone's own answer, actual %+v", res.Results)
+		}
+	}
+
+	if stats := zoned.CacheStats(); stats.Entries != 2 || stats.Hits != 2 {
+		t.Errorf("Expected an entry per zone, actual %+v", stats)
+	}
+}
+
+// fakeClock is a manually advanced clock for controlling cache expiry.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithCache(time.Minute), WithStaleWhileRevalidate(time.Minute))
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	rbl.cache.now = clock.Now
+
+	rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	// Stale entries are served immediately, with a single refresh in the background.
+	mock.delay = time.Millisecond * 200
+	clock.Advance(time.Second * 90)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")); !res.IsListed() {
+			t.Errorf("Expected the stale listing, actual %+v", res.Results)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*100 {
+		t.Errorf("Expected stale results without waiting for the refresh, actual %s", elapsed)
+	}
+
+	deadline := time.Now().Add(time.Second * 2)
+	for mock.hostQueryCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	time.Sleep(time.Millisecond * 300)
+
+	if c := mock.hostQueryCount(); c != 2 {
+		t.Errorf("Expected a single background refresh, actual %d queries", c)
+	}
+
+	// The refresh renewed the entry.
+	clock.Advance(time.Second * 30)
+	rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if c := mock.hostQueryCount(); c != 2 {
+		t.Errorf("Expected the refreshed entry to be fresh, actual %d queries", c)
+	}
+
+	// Beyond the stale window the entry is queried again before answering.
+	clock.Advance(time.Minute * 5)
+	start = time.Now()
+	rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if c := mock.hostQueryCount(); c != 3 || time.Since(start) < time.Millisecond*200 {
+		t.Errorf("Expected a synchronous query beyond the stale window, actual %d queries", c)
+	}
+}
+
+func TestCacheStaleRefreshBounded(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithCache(time.Minute), WithStaleWhileRevalidate(time.Millisecond*50))
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	rbl.cache.now = clock.Now
+
+	rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	// Without a timeout the hung refresh is only bounded by the stale window.
+	mock.delay = time.Second * 5
+	clock.Advance(time.Minute + time.Millisecond*10)
+	rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	deadline := time.Now().Add(time.Second)
+	for rbl.cache.refreshingCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if c := rbl.cache.refreshingCount(); c != 0 {
+		t.Fatalf("Expected the refresh to be abandoned after the stale window, actual %d refreshing", c)
+	}
+
+	// A later stale lookup refreshes the entry again.
+	rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	deadline = time.Now().Add(time.Second)
+	for mock.hostQueryCount() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if c := mock.hostQueryCount(); c != 3 {
+		t.Errorf("Expected a second refresh, actual %d queries", c)
+	}
+}
+
+// refreshingCount returns the number of refreshes in progress.
+func (c *resultCache) refreshingCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.refreshing)
+}
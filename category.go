@@ -0,0 +1,35 @@
+package gorbl
+
+/*
+Category describes the kind of listing an RBL reports, allowing results from many lists
+to be summarized (i.e. "flagged by 3 spam lists, 1 proxy list").
+*/
+type Category string
+
+const (
+	// CategorySpam lists hosts observed sending spam.
+	CategorySpam Category = "spam"
+	// CategoryPolicy lists hosts that shouldn't be sending mail directly, such as dynamic ranges.
+	CategoryPolicy Category = "policy"
+	// CategoryProxy lists open proxies, relays and other exploited hosts.
+	CategoryProxy Category = "proxy"
+)
+
+/*
+CountCategories returns, for each category, the number of lists the supplied results
+(one RBLResults per list queried, i.e. from a MultiRBL) report a listing on.
+Whitelists are not counted; lists without a category are counted under the empty Category.
+*/
+func CountCategories(results []RBLResults) map[Category]int {
+	counts := map[Category]int{}
+
+	for _, res := range results {
+		if res.Whitelist || !res.IsListed() {
+			continue
+		}
+
+		counts[res.Category]++
+	}
+
+	return counts
+}
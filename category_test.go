@@ -0,0 +1,43 @@
+package gorbl
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestCountCategories(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{
+			"2.0.0.127.a.example.org.": {"127.0.0.2"},
+			"2.0.0.127.b.example.org.": {"127.0.0.2"},
+			"2.0.0.127.c.example.org.": {"127.0.0.2"},
+			"2.0.0.127.w.example.org.": {"127.0.0.2"},
+			"2.0.0.127.u.example.org.": {"127.0.0.2"},
+		},
+	}
+
+	lists := []Lookuper{
+		NewRBL("a.example.org", false, WithResolver(mock), WithCategory(CategorySpam)),
+		NewRBL("b.example.org", false, WithResolver(mock), WithCategory(CategorySpam)),
+		NewRBL("c.example.org", false, WithResolver(mock), WithCategory(CategoryProxy)),
+		NewRBL("d.example.org", false, WithResolver(mock), WithCategory(CategoryPolicy)),
+		NewRBL("w.example.org", false, WithResolver(mock), WithCategory(CategorySpam), AsWhitelist()),
+		NewRBL("u.example.org", false, WithResolver(mock)),
+	}
+
+	counts := CountCategories(NewMultiRBL(lists).LookupIP(context.Background(), net.ParseIP("127.0.0.2")))
+
+	expected := map[Category]int{CategorySpam: 2, CategoryProxy: 1, "": 1}
+	if len(counts) != len(expected) {
+		t.Fatalf("Expected %v, actual %v", expected, counts)
+	}
+
+	for category, n := range expected {
+		if counts[category] != n {
+			t.Errorf("Expected %d %q lists, actual %d", n, category, counts[category])
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package gorbl
+
+import (
+	"context"
+	"net"
+)
+
+// ClassifiedCode is a return code of a listing along with its decoded names.
+type ClassifiedCode struct {
+	// Code is the returned address (i.e. 127.0.0.2)
+	Code string `json:"code"`
+	// Names are the sub-lists the code represents, if a code decoder is configured for the RBL
+	Names []string `json:"names"`
+}
+
+// Classification bundles the outcome of a lookup with its decoded return codes (see LookupIPClassified).
+type Classification struct {
+	// List is the RBL the IP was looked up in
+	List string `json:"list"`
+	// Address is the IP that was looked up
+	Address string `json:"address"`
+	// Category is the kind of listing the RBL reports, if set using WithCategory
+	Category Category `json:"category"`
+	// Listed indicates whether the IP is listed
+	Listed bool `json:"listed"`
+	// Codes holds each distinct return code of the listing, in the order they were returned
+	Codes []ClassifiedCode `json:"codes"`
+}
+
+/*
+LookupIPClassified looks up the specified IP in the RBL, returning whether it is listed along
+with each return code and the sub-list names it decodes to (see WithCodeDecoder) in a single
+call. If the IP isn't listed and a query failed, the error is returned as by LookupIPSingle.
+*/
+func (r *RBL) LookupIPClassified(ctx context.Context, ip net.IP) (Classification, error) {
+	ret := r.LookupIP(ctx, ip)
+	classification := Classification{
+		List:     ret.List,
+		Address:  ret.Host,
+		Category: ret.Category,
+		Codes:    []ClassifiedCode{},
+	}
+
+	var failure error
+	seen := map[string]bool{}
+
+	for _, res := range ret.Results {
+		if res.Failed() {
+			if failure == nil {
+				failure = res.ErrorType
+			}
+			continue
+		}
+
+		if !res.Listed || seen[res.ListedAddress] {
+			continue
+		}
+
+		seen[res.ListedAddress] = true
+		classification.Listed = true
+		classification.Codes = append(classification.Codes, ClassifiedCode{Code: res.ListedAddress, Names: res.SubLists})
+	}
+
+	if classification.Listed {
+		return classification, nil
+	}
+
+	return classification, failure
+}
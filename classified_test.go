@@ -0,0 +1,43 @@
+package gorbl
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestLookupIPClassified(t *testing.T) {
+	t.Parallel()
+	timeout := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.zen.example.org.": {"127.0.0.3", "127.0.0.10", "127.0.0.3"}},
+		errs:  map[string]error{"1.2.0.192.zen.example.org.": timeout},
+	}
+	rbl := NewRBL("zen.example.org", false, WithResolver(mock), WithCodeDecoder(ZenDecoder), WithCategory(CategorySpam))
+
+	classification, err := rbl.LookupIPClassified(context.Background(), net.ParseIP("127.0.0.2"))
+	expected := Classification{
+		List:     "zen.example.org",
+		Address:  "127.0.0.2",
+		Category: CategorySpam,
+		Listed:   true,
+		Codes: []ClassifiedCode{
+			{Code: "127.0.0.3", Names: []string{"SBL", "CSS"}},
+			{Code: "127.0.0.10", Names: []string{"PBL"}},
+		},
+	}
+	if err != nil || !reflect.DeepEqual(classification, expected) {
+		t.Errorf("Expected %+v, actual %+v (%v)", expected, classification, err)
+	}
+
+	classification, err = rbl.LookupIPClassified(context.Background(), net.ParseIP("192.0.2.2"))
+	if err != nil || classification.Listed || len(classification.Codes) != 0 {
+		t.Errorf("Expected a clean classification, actual %+v (%v)", classification, err)
+	}
+
+	if _, err = rbl.LookupIPClassified(context.Background(), net.ParseIP("192.0.2.1")); err != timeout {
+		t.Errorf("Expected the query failure, actual %v", err)
+	}
+}
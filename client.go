@@ -0,0 +1,677 @@
+package gorbl
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultMaxCNAMEDepth is the number of CNAME records a Client follows unless configured otherwise.
+const DefaultMaxCNAMEDepth = 8
+
+// DefaultClientTimeout is the time a Client waits for each server to answer unless configured otherwise.
+const DefaultClientTimeout = 5 * time.Second
+
+/*
+Client is a small DNS client exchanging messages directly with a set of nameservers.
+
+Unlike net.Resolver it exposes the details of each exchange (such as which server
+answered), making it the advanced resolver path for features needing more than the
+answers themselves. Client satisfies Resolver, so it can be supplied using WithResolver.
+*/
+type Client struct {
+	// MaxCNAMEDepth is the number of CNAME records followed when answering a query; responses
+	// with longer chains are rejected. DefaultMaxCNAMEDepth is used if zero.
+	MaxCNAMEDepth int
+	/*
+		Timeout bounds each attempt to query a server: a server not answering within Timeout
+		(or before the context is done, if sooner) is abandoned in favour of the next one.
+		DefaultClientTimeout is used if zero.
+	*/
+	Timeout time.Duration
+	/*
+		DetectDNSSECFailures enables distinguishing SERVFAIL responses caused by DNSSEC
+		validation failures: the query is retried with checking disabled, and a
+		*ServerFailureError is returned for every SERVFAIL, with DNSSECFailure set if the
+		retry succeeded. By default SERVFAIL is reported as a temporary *net.DNSError.
+	*/
+	DetectDNSSECFailures bool
+
+	/*
+		LocalIP and LocalPorts are advanced settings binding queries to a local address and
+		source port range, for environments where DNS egress is restricted by firewall rules.
+		A port is chosen at random from the range for each query, preserving source port
+		randomization. By default the OS picks both.
+	*/
+	LocalIP    net.IP
+	LocalPorts PortRange
+
+	/*
+		PoolSize enables a fast path for high-throughput scans: up to PoolSize UDP sockets per
+		server are kept open and reused across queries, avoiding a dial (and a new socket) per
+		query. Reused sockets keep their source port, trading some of the protection source
+		port randomization offers against spoofed responses for throughput. Use Close to
+		release the idle sockets. By default every query uses a new socket.
+	*/
+	PoolSize int
+
+	// servers are the nameservers (host:port) to query, tried in order until one answers.
+	servers []string
+
+	// mu guards pools.
+	mu sync.Mutex
+	// pools holds the idle connections to each server, if PoolSize is set.
+	pools map[string]chan net.Conn
+}
+
+// PortRange is an inclusive range of ports; the zero value represents any port.
+type PortRange struct {
+	// Low is the first port in the range
+	Low uint16
+	// High is the last port in the range
+	High uint16
+}
+
+// maxBindAttempts is the number of random source ports tried before a query fails to bind.
+const maxBindAttempts = 3
+
+/*
+Response holds the details of a single DNS exchange performed by a Client.
+*/
+type Response struct {
+	// Server is the nameserver (host:port) that answered
+	Server string
+	// Message is the parsed response
+	Message dnsmessage.Message
+	// Diagnostics holds the wire details of the exchange
+	Diagnostics Diagnostics
+}
+
+/*
+Diagnostics holds the wire details of a DNS exchange, an advanced diagnostic for
+troubleshooting truncation and large answers (see WithDiagnostics). Sizes are those of the
+DNS messages, excluding the length prefix used over TCP.
+*/
+type Diagnostics struct {
+	// QuerySize is the size of the query in bytes
+	QuerySize int `json:"query_size"`
+	// ResponseSize is the size of the response in bytes
+	ResponseSize int `json:"response_size"`
+	// TCP indicates the UDP response was truncated, so the query was repeated over TCP
+	TCP bool `json:"tcp"`
+	// TruncatedSize is the size in bytes of the truncated UDP response, if the query was repeated over TCP
+	TruncatedSize int `json:"truncated_size"`
+}
+
+/*
+Exchanger is implemented by resolvers able to expose the details of a DNS exchange.
+RBLs using an Exchanger record those details on each Result.
+*/
+type Exchanger interface {
+	// Exchange sends a query for the supplied name and type, returning the response.
+	Exchange(ctx context.Context, name string, qtype dnsmessage.Type) (*Response, error)
+}
+
+var (
+	_ Resolver  = (*Client)(nil)
+	_ Exchanger = (*Client)(nil)
+)
+
+// NewClient creates a new Client querying the supplied nameservers. Port 53 is assumed if a server has no port.
+func NewClient(servers ...string) *Client {
+	c := &Client{}
+
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+
+		c.servers = append(c.servers, server)
+	}
+
+	return c
+}
+
+/*
+Exchange sends a query for the supplied name and type to each of the client's servers
+in turn, returning the first response received. Each server is given Timeout to answer
+before the next is tried; the servers are only abandoned once the context is done. Responses with a failure rcode, or whose
+CNAME records loop or exceed MaxCNAMEDepth, are returned alongside an error describing the failure.
+*/
+func (c *Client) Exchange(ctx context.Context, name string, qtype dnsmessage.Type) (*Response, error) {
+	if len(c.servers) == 0 {
+		return nil, errors.New("gorbl: no nameservers configured")
+	}
+
+	qname, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name}
+	}
+
+	var lastErr error
+	for _, server := range c.servers {
+		attemptCtx, cancel := c.attempt(ctx)
+		msg, diag, err := c.exchange(attemptCtx, server, qname, qtype, false)
+		cancel()
+		if err != nil {
+			lastErr = &net.DNSError{Err: err.Error(), Name: name, Server: server, IsTimeout: isTimeout(err)}
+
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		resp := &Response{
+			Server:      server,
+			Message:     *msg,
+			Diagnostics: diag,
+		}
+
+		if msg.Header.RCode == dnsmessage.RCodeServerFailure && c.DetectDNSSECFailures {
+			return resp, c.serverFailure(ctx, server, qname, qtype)
+		}
+
+		if err := rcodeError(msg.Header.RCode, name, server); err != nil {
+			return resp, err
+		}
+
+		if _, err := followCNAMEs(*msg, c.maxCNAMEDepth()); err != nil {
+			return resp, err
+		}
+
+		return resp, nil
+	}
+
+	return nil, lastErr
+}
+
+/*
+serverFailure builds the error for a SERVFAIL response from the supplied server, retrying
+the query with checking disabled to determine whether DNSSEC validation caused the failure.
+*/
+func (c *Client) serverFailure(ctx context.Context, server string, qname dnsmessage.Name, qtype dnsmessage.Type) error {
+	ctx, cancel := c.attempt(ctx)
+	defer cancel()
+
+	msg, _, err := c.exchange(ctx, server, qname, qtype, true)
+
+	return &ServerFailureError{
+		Name:          qname.String(),
+		Server:        server,
+		DNSSECFailure: err == nil && msg.Header.RCode != dnsmessage.RCodeServerFailure,
+	}
+}
+
+// attempt returns the context bounding a single attempt to query a server, expiring after Timeout at the latest.
+func (c *Client) attempt(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultClientTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+/*
+exchange performs a single query against the supplied server over UDP, retrying over TCP
+if the response was truncated (i.e. long TXT records exceeding the 512 byte UDP limit).
+If checkingDisabled is set the server is asked not to perform DNSSEC validation.
+*/
+func (c *Client) exchange(ctx context.Context, server string, qname dnsmessage.Name, qtype dnsmessage.Type, checkingDisabled bool) (*dnsmessage.Message, Diagnostics, error) {
+	msg, diag, err := c.exchangeOver(ctx, "udp", server, qname, qtype, checkingDisabled)
+	if err != nil || !msg.Header.Truncated {
+		return msg, diag, err
+	}
+
+	msg, tcpDiag, err := c.exchangeOver(ctx, "tcp", server, qname, qtype, checkingDisabled)
+	tcpDiag.TCP = true
+	tcpDiag.TruncatedSize = diag.ResponseSize
+
+	return msg, tcpDiag, err
+}
+
+// exchangeOver performs a single query against the supplied server using the supplied network, returning the message sizes.
+func (c *Client) exchangeOver(ctx context.Context, network string, server string, qname dnsmessage.Name, qtype dnsmessage.Type, checkingDisabled bool) (*dnsmessage.Message, Diagnostics, error) {
+	var diag Diagnostics
+
+	id, err := queryID()
+	if err != nil {
+		return nil, diag, err
+	}
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true, CheckingDisabled: checkingDisabled},
+		Questions: []dnsmessage.Question{{
+			Name:  qname,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, diag, err
+	}
+	diag.QuerySize = len(packed)
+
+	pooled := network == "udp" && c.PoolSize > 0
+	var conn net.Conn
+	if pooled {
+		conn = c.pooledConn(server)
+	}
+
+	if conn == nil {
+		if conn, err = c.dial(ctx, network, server); err != nil {
+			return nil, diag, err
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Unblock the reads below if the context is cancelled before a response arrives.
+	// Pooled connections are interrupted through their deadline, and then discarded.
+	stop := context.AfterFunc(ctx, func() {
+		if pooled {
+			conn.SetDeadline(time.Now())
+		} else {
+			conn.Close()
+		}
+	})
+
+	msg, size, err := c.roundTrip(ctx, conn, network == "tcp", packed, id, qname, qtype)
+	diag.ResponseSize = size
+
+	if stopped := stop(); pooled && stopped && err == nil {
+		conn.SetDeadline(time.Time{})
+		c.putConn(server, conn)
+	} else {
+		conn.Close()
+	}
+
+	return msg, diag, err
+}
+
+// roundTrip writes the packed query to the connection and reads the matching response, returning its size.
+func (c *Client) roundTrip(ctx context.Context, conn net.Conn, stream bool, packed []byte, id uint16, qname dnsmessage.Name, qtype dnsmessage.Type) (*dnsmessage.Message, int, error) {
+	if stream {
+		// Messages sent over TCP are prefixed with their length.
+		packed = append([]byte{byte(len(packed) >> 8), byte(len(packed))}, packed...)
+	}
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, 0, ctxOr(ctx, err)
+	}
+
+	buf := make([]byte, 65535)
+	for {
+		var (
+			n   int
+			err error
+		)
+
+		if stream {
+			n, err = readStreamMessage(conn, buf)
+		} else {
+			n, err = conn.Read(buf)
+		}
+
+		if err != nil {
+			return nil, 0, ctxOr(ctx, err)
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil {
+			// A truncated response may not contain complete records; its header is enough to retry.
+			var p dnsmessage.Parser
+			if h, hErr := p.Start(buf[:n]); hErr == nil && h.Truncated && !stream {
+				msg = dnsmessage.Message{Header: h}
+				if q, qErr := p.AllQuestions(); qErr == nil {
+					msg.Questions = q
+				}
+			} else {
+				return nil, 0, err
+			}
+		}
+
+		// Ignore stray responses not matching our query (including late answers to earlier queries on pooled connections).
+		if msg.Header.ID != id || !msg.Header.Response || !matchesQuestion(msg, qname, qtype) {
+			if stream {
+				return nil, 0, errors.New("gorbl: mismatched response")
+			}
+			continue
+		}
+
+		return &msg, n, nil
+	}
+}
+
+// pool returns the idle connection pool of the supplied server, creating it if needed.
+func (c *Client) pool(server string) chan net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pools == nil {
+		c.pools = map[string]chan net.Conn{}
+	}
+
+	p, ok := c.pools[server]
+	if !ok {
+		p = make(chan net.Conn, c.PoolSize)
+		c.pools[server] = p
+	}
+
+	return p
+}
+
+// pooledConn returns an idle connection to the supplied server, or nil if none is available.
+func (c *Client) pooledConn(server string) net.Conn {
+	select {
+	case conn := <-c.pool(server):
+		return conn
+	default:
+		return nil
+	}
+}
+
+// putConn returns a connection to the supplied server's pool, closing it if the pool is full.
+func (c *Client) putConn(server string, conn net.Conn) {
+	select {
+	case c.pool(server) <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// Close closes the idle pooled connections (see PoolSize). The Client remains usable.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range c.pools {
+		for len(p) > 0 {
+			(<-p).Close()
+		}
+	}
+
+	return nil
+}
+
+// dial connects to the supplied server, binding the configured local address and port range.
+func (c *Client) dial(ctx context.Context, network string, server string) (net.Conn, error) {
+	if c.LocalIP == nil && c.LocalPorts == (PortRange{}) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, server)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < maxBindAttempts; attempt++ {
+		port, err := c.LocalPorts.random()
+		if err != nil {
+			return nil, err
+		}
+
+		d := net.Dialer{LocalAddr: &net.UDPAddr{IP: c.LocalIP, Port: port}}
+		if network == "tcp" {
+			d.LocalAddr = &net.TCPAddr{IP: c.LocalIP, Port: port}
+		}
+
+		conn, err := d.DialContext(ctx, network, server)
+		if err == nil || !errors.Is(err, syscall.EADDRINUSE) {
+			return conn, err
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// random returns a random port within the range, or 0 (any port) for the zero value.
+func (p PortRange) random() (int, error) {
+	if p == (PortRange{}) {
+		return 0, nil
+	}
+
+	if p.High < p.Low {
+		return 0, fmt.Errorf("gorbl: invalid port range %d-%d", p.Low, p.High)
+	}
+
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+
+	return int(p.Low) + int(binary.BigEndian.Uint16(b[:]))%(int(p.High-p.Low)+1), nil
+}
+
+// readStreamMessage reads a single length-prefixed DNS message from a stream connection into buf.
+func readStreamMessage(conn net.Conn, buf []byte) (int, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return 0, err
+	}
+
+	n := int(binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// ctxOr returns the context's error if it is done, otherwise the supplied error.
+func ctxOr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
+
+// LookupHost returns the IPv4 addresses the supplied host resolves to.
+func (c *Client) LookupHost(ctx context.Context, host string) ([]string, error) {
+	resp, err := c.Exchange(ctx, host, dnsmessage.TypeA)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, rr := range answers(resp.Message, dnsmessage.TypeA) {
+		a := rr.Body.(*dnsmessage.AResource)
+		addrs = append(addrs, net.IP(a.A[:]).String())
+	}
+
+	if len(addrs) == 0 {
+		return nil, noAnswerError(host, resp.Server)
+	}
+
+	return addrs, nil
+}
+
+// LookupTXT returns the TXT records for the supplied name, joining the strings of each record.
+func (c *Client) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	resp, err := c.Exchange(ctx, name, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	var txts []string
+	for _, rr := range answers(resp.Message, dnsmessage.TypeTXT) {
+		txts = append(txts, strings.Join(rr.Body.(*dnsmessage.TXTResource).TXT, ""))
+	}
+
+	if len(txts) == 0 {
+		return nil, noAnswerError(name, resp.Server)
+	}
+
+	return txts, nil
+}
+
+// LookupIPAddr returns the IPv4 and IPv6 addresses of the supplied host.
+func (c *Client) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var (
+		addrs   []net.IPAddr
+		lastErr error
+	)
+
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		resp, err := c.Exchange(ctx, host, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for _, rr := range answers(resp.Message, qtype) {
+			switch body := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, net.IPAddr{IP: net.IP(body.A[:])})
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, net.IPAddr{IP: net.IP(body.AAAA[:])})
+			}
+		}
+	}
+
+	if len(addrs) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, noAnswerError(host, "")
+	}
+
+	return addrs, nil
+}
+
+// maxCNAMEDepth returns the configured CNAME depth, or the default if unset.
+func (c *Client) maxCNAMEDepth() int {
+	if c.MaxCNAMEDepth > 0 {
+		return c.MaxCNAMEDepth
+	}
+
+	return DefaultMaxCNAMEDepth
+}
+
+/*
+answers returns the records of the supplied type answering the message's question,
+following any CNAME records in the answer section. Nothing is returned if the CNAME records loop.
+*/
+func answers(msg dnsmessage.Message, qtype dnsmessage.Type) []dnsmessage.Resource {
+	// Every step of a chain uses a distinct record, bounding the depth worth following.
+	target, err := followCNAMEs(msg, len(msg.Answers))
+	if err != nil {
+		return nil
+	}
+
+	var matched []dnsmessage.Resource
+	for _, rr := range msg.Answers {
+		if rr.Header.Type == qtype && strings.EqualFold(rr.Header.Name.String(), target) {
+			matched = append(matched, rr)
+		}
+	}
+
+	return matched
+}
+
+/*
+followCNAMEs follows the CNAME records in the answer section from the message's question,
+returning the final name. An error is returned if the chain loops or is longer than maxDepth.
+*/
+func followCNAMEs(msg dnsmessage.Message, maxDepth int) (string, error) {
+	if len(msg.Questions) == 0 {
+		return "", nil
+	}
+
+	target := msg.Questions[0].Name.String()
+	seen := map[string]bool{strings.ToLower(target): true}
+
+	for depth := 0; ; depth++ {
+		cname, ok := cnameOf(msg, target)
+		if !ok {
+			return target, nil
+		}
+
+		if seen[strings.ToLower(cname)] {
+			return "", fmt.Errorf("%w: %s points back to %s", ErrCNAMELoop, target, cname)
+		}
+
+		if depth >= maxDepth {
+			return "", fmt.Errorf("%w: more than %d records following %s", ErrCNAMEDepth, maxDepth, msg.Questions[0].Name)
+		}
+
+		seen[strings.ToLower(cname)] = true
+		target = cname
+	}
+}
+
+// cnameOf returns the target of the CNAME record for the supplied name in the answer section, if any.
+func cnameOf(msg dnsmessage.Message, name string) (string, bool) {
+	for _, rr := range msg.Answers {
+		if body, ok := rr.Body.(*dnsmessage.CNAMEResource); ok && strings.EqualFold(rr.Header.Name.String(), name) {
+			return body.CNAME.String(), true
+		}
+	}
+
+	return "", false
+}
+
+// matchesQuestion returns true if the message answers the supplied question.
+func matchesQuestion(msg dnsmessage.Message, qname dnsmessage.Name, qtype dnsmessage.Type) bool {
+	return len(msg.Questions) == 1 &&
+		msg.Questions[0].Type == qtype &&
+		strings.EqualFold(msg.Questions[0].Name.String(), qname.String())
+}
+
+// rcodeError converts a failure rcode into an error compatible with those returned by net.Resolver.
+func rcodeError(rcode dnsmessage.RCode, name string, server string) error {
+	switch rcode {
+	case dnsmessage.RCodeSuccess:
+		return nil
+	case dnsmessage.RCodeNameError:
+		return &net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+	case dnsmessage.RCodeServerFailure:
+		return &net.DNSError{Err: "server misbehaving", Name: name, Server: server, IsTemporary: true}
+	}
+
+	return &net.DNSError{Err: fmt.Sprintf("unexpected rcode %s", rcode), Name: name, Server: server}
+}
+
+// noAnswerError reports a successful response without any records of the requested type.
+func noAnswerError(name string, server string) error {
+	return &net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+}
+
+// isTimeout returns true if the supplied error is a network timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// fqdn returns the supplied name with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
+
+// queryID returns a random DNS message ID.
+func queryID() (uint16, error) {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint16(b[:]), nil
+}
@@ -0,0 +1,519 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testHandler builds the response for a query received by a test DNS server.
+type testHandler func(q dnsmessage.Message) dnsmessage.Message
+
+/*
+startTestServer starts a UDP and TCP DNS server on the loopback interface, returning its
+address. UDP responses over 512 bytes are truncated, as a real server would.
+*/
+func startTestServer(t testing.TB, handler testHandler) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	l, err := net.Listen("tcp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Unable to start test server: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	respond := func(req []byte, udp bool) []byte {
+		var q dnsmessage.Message
+		if err := q.Unpack(req); err != nil {
+			return nil
+		}
+
+		resp := handler(q)
+		resp.Header.ID = q.Header.ID
+		resp.Header.Response = true
+		resp.Questions = q.Questions
+
+		packed, err := resp.Pack()
+		if err != nil {
+			return nil
+		}
+
+		if udp && len(packed) > 512 {
+			resp.Header.Truncated = true
+			resp.Answers = nil
+			packed, _ = resp.Pack()
+		}
+
+		return packed
+	}
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			if packed := respond(buf[:n], true); packed != nil {
+				conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(c net.Conn) {
+				defer c.Close()
+
+				buf := make([]byte, 65535)
+				n, err := readStreamMessage(c, buf)
+				if err != nil {
+					return
+				}
+
+				if packed := respond(buf[:n], false); packed != nil {
+					c.Write(append([]byte{byte(len(packed) >> 8), byte(len(packed))}, packed...))
+				}
+			}(c)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// zoneHandler answers A and TXT queries from static maps, returning NXDOMAIN for anything else.
+func zoneHandler(a map[string][4]byte, txt map[string]string) testHandler {
+	return func(q dnsmessage.Message) dnsmessage.Message {
+		question := q.Questions[0]
+		name := strings.ToLower(question.Name.String())
+		hdr := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60}
+
+		var resp dnsmessage.Message
+		switch {
+		case question.Type == dnsmessage.TypeA && a[name] != [4]byte{}:
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: a[name]}})
+		case question.Type == dnsmessage.TypeTXT && len(txt[name]) > 0:
+			// TXT strings are limited to 255 bytes, so longer records are split across several.
+			var segments []string
+			for record := txt[name]; len(record) > 0; {
+				n := min(len(record), 255)
+				segments = append(segments, record[:n])
+				record = record[n:]
+			}
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.TXTResource{TXT: segments}})
+		case a[name] == [4]byte{} && len(txt[name]) == 0:
+			resp.Header.RCode = dnsmessage.RCodeNameError
+		}
+
+		return resp
+	}
+}
+
+func TestClientLookupHost(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, zoneHandler(map[string][4]byte{"2.0.0.127.dnsbl.example.org.": {127, 0, 0, 2}}, nil))
+	c := NewClient(server)
+
+	addrs, err := c.LookupHost(context.Background(), "2.0.0.127.dnsbl.example.org.")
+	if err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.2" {
+		t.Errorf("Expected 127.0.0.2, actual %v (%v)", addrs, err)
+	}
+
+	if _, err := c.LookupHost(context.Background(), "1.2.0.192.dnsbl.example.org."); !isNotFound(err) {
+		t.Errorf("Expected a not found error, actual %v", err)
+	}
+}
+
+func TestClientLookupTXT(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, zoneHandler(nil, map[string]string{"2.0.0.127.dnsbl.example.org.": "Listed for spam"}))
+	c := NewClient(server)
+
+	txt, err := c.LookupTXT(context.Background(), "2.0.0.127.dnsbl.example.org")
+	if err != nil || len(txt) != 1 || txt[0] != "Listed for spam" {
+		t.Errorf("Expected the TXT record, actual %v (%v)", txt, err)
+	}
+}
+
+func TestClientFollowsCNAME(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, func(q dnsmessage.Message) dnsmessage.Message {
+		target := dnsmessage.MustNewName("target.example.org.")
+		return dnsmessage.Message{Answers: []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.CNAMEResource{CNAME: target},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{Name: target, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 3}},
+			},
+		}}
+	})
+	c := NewClient(server)
+
+	addrs, err := c.LookupHost(context.Background(), "alias.example.org.")
+	if err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.3" {
+		t.Errorf("Expected the CNAME target's address, actual %v (%v)", addrs, err)
+	}
+}
+
+// cnameChainHandler answers every query with a chain of CNAME records through the supplied names.
+func cnameChainHandler(names ...string) testHandler {
+	return func(q dnsmessage.Message) dnsmessage.Message {
+		var resp dnsmessage.Message
+
+		owner := q.Questions[0].Name
+		for _, name := range names {
+			target := dnsmessage.MustNewName(name)
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: owner, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.CNAMEResource{CNAME: target},
+			})
+			owner = target
+		}
+
+		return resp
+	}
+}
+
+func TestClientCNAMELoop(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, cnameChainHandler("a.example.org.", "b.example.org.", "a.example.org."))
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(NewClient(server)))
+
+	if _, err := NewClient(server).LookupHost(context.Background(), "alias.example.org."); !errors.Is(err, ErrCNAMELoop) {
+		t.Errorf("Expected a CNAME loop error, actual %v", err)
+	}
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.IsListed() || !res.Results[0].Failed() || !errors.Is(res.Results[0].ErrorType, ErrCNAMELoop) {
+		t.Errorf("Expected the loop to be reported as a failure, actual %+v", res.Results)
+	}
+}
+
+func TestClientMaxCNAMEDepth(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, cnameChainHandler("a.example.org.", "b.example.org.", "c.example.org."))
+
+	c := NewClient(server)
+	if _, err := c.LookupHost(context.Background(), "alias.example.org."); !isNotFound(err) {
+		t.Errorf("Expected the chain to be followed by default, actual %v", err)
+	}
+
+	c.MaxCNAMEDepth = 2
+	if _, err := c.LookupHost(context.Background(), "alias.example.org."); !errors.Is(err, ErrCNAMEDepth) {
+		t.Errorf("Expected a CNAME depth error, actual %v", err)
+	}
+}
+
+func TestLookupIPAnsweredBy(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, zoneHandler(map[string][4]byte{"2.0.0.127.dnsbl.example.org.": {127, 0, 0, 2}}, nil))
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(NewClient(server)))
+
+	for _, ip := range []string{"127.0.0.2", "192.0.2.1"} {
+		res := rbl.LookupIP(context.Background(), net.ParseIP(ip))
+
+		if len(res.Results) != 1 || res.Results[0].AnsweredBy != server {
+			t.Errorf("Expected %s to be answered by %s, actual %+v", ip, server, res.Results)
+		}
+	}
+
+	res := NewRBL("dnsbl.example.org", false, WithResolver(&mockResolver{})).LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if res.Results[0].AnsweredBy != "" {
+		t.Errorf("Expected no AnsweredBy for the standard resolver path, actual %s", res.Results[0].AnsweredBy)
+	}
+}
+
+func TestClientLookupLongTXT(t *testing.T) {
+	t.Parallel()
+	long := strings.Repeat("Listed for sending spam, see https://dnsbl.example.org/ for details. ", 12)
+	server := startTestServer(t, zoneHandler(nil, map[string]string{"2.0.0.127.dnsbl.example.org.": long}))
+	c := NewClient(server)
+
+	txt, err := c.LookupTXT(context.Background(), "2.0.0.127.dnsbl.example.org.")
+	if err != nil || len(txt) != 1 || txt[0] != long {
+		t.Errorf("Expected the full %d byte TXT record over TCP, actual %v (%v)", len(long), txt, err)
+	}
+}
+
+func TestLookupIPResponseMeta(t *testing.T) {
+	t.Parallel()
+	zone := zoneHandler(map[string][4]byte{"2.0.0.127.dnsbl.example.org.": {127, 0, 0, 2}}, nil)
+	server := startTestServer(t, func(q dnsmessage.Message) dnsmessage.Message {
+		resp := zone(q)
+		resp.Header.Authoritative = true
+		return resp
+	})
+
+	res := NewRBL("dnsbl.example.org", false, WithResolver(NewClient(server))).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.Results[0].Meta != nil {
+		t.Errorf("Expected no response metadata by default, actual %+v", res.Results[0].Meta)
+	}
+
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(NewClient(server)), WithResponseMeta())
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	expected := ResponseMeta{RCode: dnsmessage.RCodeSuccess, Answers: 1, Authoritative: true}
+	if m := res.Results[0].Meta; m == nil || *m != expected {
+		t.Errorf("Expected %+v, actual %+v", expected, m)
+	}
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	expected = ResponseMeta{RCode: dnsmessage.RCodeNameError, Authoritative: true}
+	if m := res.Results[0].Meta; m == nil || *m != expected {
+		t.Errorf("Expected %+v, actual %+v", expected, m)
+	}
+}
+
+func TestClientDetectDNSSECFailures(t *testing.T) {
+	t.Parallel()
+	zone := zoneHandler(map[string][4]byte{"2.0.0.127.dnsbl.example.org.": {127, 0, 0, 2}}, nil)
+	server := startTestServer(t, func(q dnsmessage.Message) dnsmessage.Message {
+		// 2.0.0.127 answers once validation is disabled; everything else always fails.
+		if !q.Header.CheckingDisabled || q.Questions[0].Name.String() != "2.0.0.127.dnsbl.example.org." {
+			return dnsmessage.Message{Header: dnsmessage.Header{RCode: dnsmessage.RCodeServerFailure}}
+		}
+		return zone(q)
+	})
+
+	var netErr *net.DNSError
+	if _, err := NewClient(server).LookupHost(context.Background(), "2.0.0.127.dnsbl.example.org."); !errors.As(err, &netErr) || !netErr.IsTemporary {
+		t.Errorf("Expected a temporary DNS error by default, actual %v", err)
+	}
+
+	c := NewClient(server)
+	c.DetectDNSSECFailures = true
+
+	var sfErr *ServerFailureError
+	if _, err := c.LookupHost(context.Background(), "2.0.0.127.dnsbl.example.org."); !errors.As(err, &sfErr) || !sfErr.DNSSECFailure {
+		t.Errorf("Expected a DNSSEC failure, actual %v", err)
+	}
+
+	if _, err := c.LookupHost(context.Background(), "1.2.0.192.dnsbl.example.org."); !errors.As(err, &sfErr) || sfErr.DNSSECFailure {
+		t.Errorf("Expected a plain server failure, actual %v", err)
+	}
+
+	res := NewRBL("dnsbl.example.org", false, WithResolver(c)).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if !res.Results[0].Failed() || !errors.As(res.Results[0].ErrorType, &sfErr) || !sfErr.DNSSECFailure {
+		t.Errorf("Expected the DNSSEC failure on the result, actual %+v", res.Results)
+	}
+}
+
+func TestClientTimeoutTriesNextServer(t *testing.T) {
+	t.Parallel()
+	// The first server receives queries but never answers them.
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server: %v", err)
+	}
+	t.Cleanup(func() { silent.Close() })
+
+	server := startTestServer(t, zoneHandler(map[string][4]byte{"2.0.0.127.dnsbl.example.org.": {127, 0, 0, 2}}, nil))
+	c := NewClient(silent.LocalAddr().String(), server)
+	c.Timeout = 100 * time.Millisecond
+
+	resp, err := c.Exchange(context.Background(), "2.0.0.127.dnsbl.example.org.", dnsmessage.TypeA)
+	if err != nil || resp.Server != server {
+		t.Fatalf("Expected an answer from %s, actual %v (%v)", server, resp, err)
+	}
+
+	// Once the context is done the remaining servers are not tried.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Exchange(ctx, "2.0.0.127.dnsbl.example.org.", dnsmessage.TypeA); !isTimeout(err) {
+		t.Errorf("Expected a timeout, actual %v", err)
+	}
+}
+
+func TestClientLocalAddr(t *testing.T) {
+	t.Parallel()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// Answer NXDOMAIN to every query, recording the address each came from.
+	sources := make(chan net.Addr, 16)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var q dnsmessage.Message
+			if q.Unpack(buf[:n]) != nil {
+				continue
+			}
+			sources <- addr
+
+			q.Header.Response = true
+			q.Header.RCode = dnsmessage.RCodeNameError
+			if packed, err := q.Pack(); err == nil {
+				conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+
+	c := NewClient(conn.LocalAddr().String())
+	c.LocalIP = net.IPv4(127, 0, 0, 1)
+	c.LocalPorts = PortRange{Low: 40000, High: 40100}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.LookupHost(context.Background(), "1.2.0.192.dnsbl.example.org."); !isNotFound(err) {
+			t.Fatalf("Expected a not found error, actual %v", err)
+		}
+
+		src := (<-sources).(*net.UDPAddr)
+		if !src.IP.Equal(c.LocalIP) || src.Port < 40000 || src.Port > 40100 {
+			t.Errorf("Expected a source within 127.0.0.1:40000-40100, actual %s", src)
+		}
+	}
+
+	c.LocalPorts = PortRange{Low: 2, High: 1}
+	if _, err := c.LookupHost(context.Background(), "1.2.0.192.dnsbl.example.org."); err == nil || isNotFound(err) {
+		t.Errorf("Expected an invalid port range to be rejected, actual %v", err)
+	}
+}
+
+func TestClientPoolReusesConnections(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, zoneHandler(map[string][4]byte{"2.0.0.127.dnsbl.example.org.": {127, 0, 0, 2}}, nil))
+
+	c := NewClient(server)
+	c.PoolSize = 2
+	t.Cleanup(func() { c.Close() })
+
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(c))
+	for i := 0; i < 5; i++ {
+		if res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")); !res.IsListed() {
+			t.Fatalf("Expected a listing over the pooled connection, actual %+v", res.Results)
+		}
+	}
+
+	// Sequential queries share a single socket.
+	if n := len(c.pool(server)); n != 1 {
+		t.Errorf("Expected a single idle pooled connection, actual %d", n)
+	}
+
+	// A cancelled query discards its connection rather than returning it to the pool.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.LookupHost(ctx, "2.0.0.127.dnsbl.example.org."); err == nil {
+		t.Errorf("Expected the cancelled query to fail")
+	}
+
+	if n := len(c.pool(server)); n != 0 {
+		t.Errorf("Expected the cancelled query's connection to be discarded, actual %d idle", n)
+	}
+
+	c.Close()
+	if res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")); !res.IsListed() {
+		t.Errorf("Expected the client to remain usable after Close, actual %+v", res.Results)
+	}
+}
+
+// benchmarkLookupIP measures listed lookups against a local test server using the supplied RBL options.
+func benchmarkLookupIP(b *testing.B, opts func(server string) []Option) {
+	server := startTestServer(b, zoneHandler(map[string][4]byte{"2.0.0.127.dnsbl.example.org.": {127, 0, 0, 2}}, nil))
+	rbl := NewRBL("dnsbl.example.org", false, opts(server)...)
+	ip := net.ParseIP("127.0.0.2")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if res := rbl.LookupIP(context.Background(), ip); !res.IsListed() {
+			b.Fatalf("Expected a listing, actual %+v", res.Results)
+		}
+	}
+}
+
+func BenchmarkLookupIPNetResolver(b *testing.B) {
+	benchmarkLookupIP(b, func(server string) []Option {
+		return []Option{WithDialer(func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		})}
+	})
+}
+
+func BenchmarkLookupIPClient(b *testing.B) {
+	benchmarkLookupIP(b, func(server string) []Option {
+		return []Option{WithResolver(NewClient(server))}
+	})
+}
+
+func BenchmarkLookupIPPooledClient(b *testing.B) {
+	benchmarkLookupIP(b, func(server string) []Option {
+		c := NewClient(server)
+		c.PoolSize = 4
+		b.Cleanup(func() { c.Close() })
+
+		return []Option{WithResolver(c)}
+	})
+}
+
+func TestLookupIPDiagnostics(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, func(q dnsmessage.Message) dnsmessage.Message {
+		question := q.Questions[0]
+		if question.Type != dnsmessage.TypeA {
+			return dnsmessage.Message{Header: dnsmessage.Header{RCode: dnsmessage.RCodeNameError}}
+		}
+
+		// 127.0.0.3 is listed for a large number of reasons, exceeding the UDP limit.
+		count := 1
+		if strings.HasPrefix(question.Name.String(), "3.") {
+			count = 60
+		}
+
+		var resp dnsmessage.Message
+		hdr := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60}
+		for i := 0; i < count; i++ {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, byte(i + 2)}}})
+		}
+		return resp
+	})
+
+	res := NewRBL("dnsbl.example.org", false, WithResolver(NewClient(server))).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.Results[0].Diagnostics != nil {
+		t.Errorf("Expected no diagnostics by default, actual %+v", res.Results[0].Diagnostics)
+	}
+
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(NewClient(server)), WithDiagnostics())
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if d := res.Results[0].Diagnostics; d == nil || d.QuerySize == 0 || d.ResponseSize <= d.QuerySize || d.TCP || d.TruncatedSize != 0 {
+		t.Errorf("Expected the sizes of a UDP exchange, actual %+v", d)
+	}
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.3"))
+	if len(res.Results) != 60 {
+		t.Fatalf("Expected every answer over TCP, actual %d", len(res.Results))
+	}
+
+	if d := res.Results[0].Diagnostics; d == nil || !d.TCP || d.TruncatedSize == 0 || d.TruncatedSize > 512 || d.ResponseSize <= 512 {
+		t.Errorf("Expected the TCP fallback to be reported, actual %+v", d)
+	}
+}
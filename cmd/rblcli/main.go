@@ -1,48 +1,161 @@
+/*
+Command rblcli looks up IPs and hosts against a set of RBLs.
+
+rblcli exits with one of the following codes, allowing scripts to branch on the result:
+
+	0 - the target(s) are not listed on any list
+	1 - a target is listed on at least one list
+	2 - usage error, or a lookup failed without any target being listed
+*/
 package main
 
 import (
 	"flag"
 	"fmt"
+	"io"
 	"net"
+	"os"
 
 	"github.com/rmrobinson-textnow/gorbl"
 	"golang.org/x/net/context"
 )
 
+// Exit codes reported by rblcli.
+const (
+	exitClean  = 0
+	exitListed = 1
+	exitError  = 2
+)
+
 func main() {
+	os.Exit(run())
+}
+
+// run performs the lookups requested on the command line, returning the exit code.
+func run() int {
 	var (
 		host = flag.String("host", "", "The host to lookup. Mutually exclusive to IP")
 		ip   = flag.String("ip", "", "The IP to lookup. Mutually exclusive to host")
+		list = flag.String("list", "", "The RBL to query. Defaults to a curated set of public lists")
 	)
 
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "If neither -ip nor -host is supplied, IPs and hosts are read from stdin (one per line, with '#' starting a comment).\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Exits 0 if clean, 1 if listed and 2 on usage or lookup errors.\n\n")
+		flag.PrintDefaults()
+	}
+
 	flag.Parse()
 
 	if len(*host) > 0 && len(*ip) > 0 {
 		fmt.Printf("Only one of IP or host can be supplied\n")
-		return
+		return exitError
 	}
 
-	rbl := gorbl.NewRBL("bl.mailspike.net", true)
+	var rbls []gorbl.Lookuper
+
+	if len(*list) > 0 {
+		rbls = append(rbls, gorbl.NewRBL(*list, true))
+	} else {
+		for _, rbl := range gorbl.DefaultLists() {
+			rbls = append(rbls, rbl)
+		}
+	}
 
-	var ret gorbl.RBLResults
+	m := gorbl.NewMultiRBL(rbls)
 
-	if len(*host) > 0 {
-		ret = rbl.Lookup(context.Background(), *host)
-	} else if len(*ip) > 0 {
+	if len(*ip) == 0 && len(*host) == 0 {
+		return scan(os.Stdin, os.Stdout, m)
+	}
+
+	var rets []gorbl.RBLResults
+
+	if len(*ip) > 0 {
 		parsedIP := net.ParseIP(*ip)
 
 		if parsedIP == nil {
 			fmt.Printf("Supplied IP unable to be parsed\n")
-			return
+			return exitError
 		}
 
-		ret = rbl.LookupIP(context.Background(), parsedIP)
+		rets = m.LookupIP(context.Background(), parsedIP)
 	} else {
-		fmt.Printf("One of IP or host must be supplied\n")
-		return
+		rets = m.Lookup(context.Background(), *host)
 	}
 
-	for _, res := range ret.Results {
-		fmt.Printf("%+v\n", res)
+	for _, ret := range rets {
+		for _, res := range ret.Results {
+			fmt.Printf("%s: %+v\n", ret.List, res)
+		}
 	}
+
+	return exitCode(rets)
+}
+
+// exitCode returns the exit code reflecting the supplied results.
+func exitCode(rets []gorbl.RBLResults) int {
+	failed := false
+
+	for _, ret := range rets {
+		if ret.IsListed() {
+			return exitListed
+		}
+
+		for _, res := range ret.Results {
+			failed = failed || res.Failed()
+		}
+	}
+
+	if failed {
+		return exitError
+	}
+
+	return exitClean
+}
+
+// worst returns the more significant of two exit codes: listed, then error, then clean.
+func worst(a int, b int) int {
+	if a == exitListed || b == exitListed {
+		return exitListed
+	}
+
+	if a == exitError || b == exitError {
+		return exitError
+	}
+
+	return exitClean
+}
+
+/*
+scan looks up every IP or host read from r (see gorbl.MultiRBL.ScanReaderFunc), writing one
+line per input to w as soon as its lookup completes, so followed input (i.e. tail -f) is
+reported as it arrives. Blank lines and comments are skipped; malformed lines are reported
+and exit with an error unless a target is listed.
+*/
+func scan(r io.Reader, w io.Writer, m *gorbl.MultiRBL) int {
+	code := exitClean
+
+	err := m.ScanReaderFunc(context.Background(), r, func(res gorbl.MultiScanResult) {
+		if res.Err != nil {
+			fmt.Fprintf(w, "%s: %v\n", res.Input, res.Err)
+			code = worst(code, exitError)
+			return
+		}
+
+		fmt.Fprintln(w, summarize(res.Input, res.Results))
+		code = worst(code, exitCode(res.Results))
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read input: %v\n", err)
+		return worst(code, exitError)
+	}
+
+	return code
+}
+
+// summarize formats the results for a single input as one line.
+func summarize(input string, rets []gorbl.RBLResults) string {
+	return fmt.Sprintf("%s: %s", input, gorbl.Evaluate(rets, nil))
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmrobinson-textnow/gorbl"
+	"golang.org/x/net/context"
+)
+
+// staticResolver is a gorbl.Resolver answering from a static map of A records.
+type staticResolver map[string][]string
+
+func (s staticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := s[host]; ok {
+		return addrs, nil
+	}
+
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (s staticResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (s staticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// testMulti returns a MultiRBL listing 192.0.2.1 only.
+func testMulti() *gorbl.MultiRBL {
+	resolver := staticResolver{"1.2.0.192.dnsbl.example.org.": {"127.0.0.2"}}
+	return gorbl.NewMultiRBL([]gorbl.Lookuper{gorbl.NewRBL("dnsbl.example.org", false, gorbl.WithResolver(resolver))})
+}
+
+func TestScanSkipsCommentsAndBlankLines(t *testing.T) {
+	var out bytes.Buffer
+	code := scan(strings.NewReader("# header\n\n192.0.2.2 # trailing comment\n   \n"), &out, testMulti())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "192.0.2.2: ") {
+		t.Errorf("Expected a single line for 192.0.2.2, actual %q", out.String())
+	}
+
+	if code != exitClean {
+		t.Errorf("Expected exit code %d, actual %d", exitClean, code)
+	}
+}
+
+func TestScanListed(t *testing.T) {
+	var out bytes.Buffer
+	code := scan(strings.NewReader("192.0.2.2\n192.0.2.1\n"), &out, testMulti())
+
+	// Lines are written as lookups complete, so may not follow the input order.
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "192.0.2.1: ") || !strings.HasPrefix(lines[1], "192.0.2.2: ") {
+		t.Errorf("Expected a line per input, actual %q", out.String())
+	}
+
+	if code != exitListed {
+		t.Errorf("Expected exit code %d, actual %d", exitListed, code)
+	}
+}
+
+func TestScanInvalidLines(t *testing.T) {
+	var out bytes.Buffer
+	code := scan(strings.NewReader("not a host\n192.0.2.2\n"), &out, testMulti())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(out.String(), "not a host: ") || !strings.Contains(out.String(), "invalid input") {
+		t.Errorf("Expected the invalid line to be reported, actual %q", out.String())
+	}
+
+	if code != exitError {
+		t.Errorf("Expected exit code %d, actual %d", exitError, code)
+	}
+
+	// A listing takes precedence over invalid lines.
+	if code := scan(strings.NewReader("not a host\n192.0.2.1\n"), &out, testMulti()); code != exitListed {
+		t.Errorf("Expected exit code %d, actual %d", exitListed, code)
+	}
+}
+
+// lineWriter is an io.Writer sending everything written to it on the channel.
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestScanStreams(t *testing.T) {
+	pr, pw := io.Pipe()
+	out := make(lineWriter, 4)
+
+	done := make(chan int)
+	go func() {
+		done <- scan(pr, out, testMulti())
+	}()
+
+	// Each result is written while the input is still open, as when following a log.
+	for _, ip := range []string{"192.0.2.2", "192.0.2.1"} {
+		fmt.Fprintln(pw, ip)
+
+		select {
+		case line := <-out:
+			if !strings.HasPrefix(line, ip+": ") {
+				t.Errorf("Expected the result for %s, actual %q", ip, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the result for %s before the input was closed", ip)
+		}
+	}
+
+	pw.Close()
+	if code := <-done; code != exitListed {
+		t.Errorf("Expected exit code %d, actual %d", exitListed, code)
+	}
+}
@@ -0,0 +1,75 @@
+package gorbl
+
+import (
+	"fmt"
+	"net"
+)
+
+// defaultListingNet is the range returned addresses must fall in to be treated as listings, unless configured otherwise.
+var defaultListingNet = net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)}
+
+// queryErrorNet is the range (127.255.255.0/24) lists such as Spamhaus use to signal query errors.
+var queryErrorNet = net.IPNet{IP: net.IPv4(127, 255, 255, 0), Mask: net.CIDRMask(24, 32)}
+
+// queryErrorReasons maps the well-known query error codes to their meaning.
+var queryErrorReasons = map[string]string{
+	"127.255.255.252": "typing error in DNSBL name",
+	"127.255.255.254": "query refused (public or open resolver)",
+	"127.255.255.255": "excessive number of queries",
+}
+
+/*
+QueryError is reported when an RBL answers with a code in 127.255.255.0/24, indicating the
+query itself was rejected rather than the IP being listed.
+*/
+type QueryError struct {
+	// Code is the address returned by the RBL (i.e. 127.255.255.254)
+	Code string `json:"code"`
+	// Reason describes the error signalled by the code
+	Reason string `json:"reason"`
+}
+
+// Error returns the code and reason of the query error.
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("gorbl: query error %s: %s", e.Code, e.Reason)
+}
+
+/*
+ParseQueryError returns the QueryError signalled by the supplied returned address, or false
+if the address isn't in the query error range.
+*/
+func ParseQueryError(addr string) (*QueryError, bool) {
+	ip, _, err := ParseReturnCode(addr)
+	if err != nil || !queryErrorNet.Contains(ip) {
+		return nil, false
+	}
+
+	reason, ok := queryErrorReasons[ip.String()]
+	if !ok {
+		reason = "unknown query error"
+	}
+
+	return &QueryError{Code: ip.String(), Reason: reason}, true
+}
+
+/*
+AnswerInterpreter decides whether an address returned by an RBL is a listing, for the
+minority of lists that don't follow the 127.0.0.0/8 convention (i.e. answering with the
+queried IP with a bit flipped to encode data). It receives the searched IP (nil if the
+searched value isn't an IP, i.e. for LookupLabel) and the returned address, and returns
+whether it is a listing along with an optional reason (see Result.Reason).
+*/
+type AnswerInterpreter func(queried net.IP, answer net.IP) (listed bool, reason string)
+
+/*
+ParseReturnCode parses the address returned by an RBL (i.e. Result.ListedAddress) into its
+4-byte IP and octets, returning an error wrapping ErrInvalidInput if it isn't an IPv4 address.
+*/
+func ParseReturnCode(code string) (net.IP, [4]byte, error) {
+	ip := net.ParseIP(code).To4()
+	if ip == nil {
+		return nil, [4]byte{}, fmt.Errorf("%w: %q is not an IPv4 return code", ErrInvalidInput, code)
+	}
+
+	return ip, [4]byte(ip), nil
+}
@@ -0,0 +1,104 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestParseQueryError(t *testing.T) {
+	t.Parallel()
+	cases := map[string]string{
+		"127.255.255.252": "typing error in DNSBL name",
+		"127.255.255.254": "query refused (public or open resolver)",
+		"127.255.255.255": "excessive number of queries",
+		"127.255.255.1":   "unknown query error",
+	}
+
+	for code, reason := range cases {
+		qErr, ok := ParseQueryError(code)
+		if !ok || qErr.Code != code || qErr.Reason != reason {
+			t.Errorf("Expected %q for %s, actual %+v", reason, code, qErr)
+		}
+	}
+
+	for _, addr := range []string{"127.0.0.2", "127.255.254.1", "garbage"} {
+		if _, ok := ParseQueryError(addr); ok {
+			t.Errorf("Expected %s to not be a query error", addr)
+		}
+	}
+}
+
+func TestLookupIPQueryErrorCode(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.255.255.254"}},
+	}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	if len(res.Results) != 1 || res.Results[0].Listed || !res.Results[0].Error {
+		t.Fatalf("Expected a not-listed error result, actual %+v", res.Results)
+	}
+
+	var qErr *QueryError
+	if !errors.As(res.Results[0].ErrorType, &qErr) || qErr.Code != "127.255.255.254" {
+		t.Errorf("Expected a QueryError for 127.255.255.254, actual %v", res.Results[0].ErrorType)
+	}
+
+	if c := mock.txtQueryCount(); c != 0 {
+		t.Errorf("Expected no TXT queries for a query error, actual %d", c)
+	}
+}
+
+func TestParseReturnCode(t *testing.T) {
+	t.Parallel()
+	ip, octets, err := ParseReturnCode("127.0.1.4")
+	if err != nil || !ip.Equal(net.IPv4(127, 0, 1, 4)) || len(ip) != net.IPv4len || octets != [4]byte{127, 0, 1, 4} {
+		t.Errorf("Expected 127.0.1.4, actual %v %v (%v)", ip, octets, err)
+	}
+
+	for _, code := range []string{"", "not an address", "2001:db8::2", "127.0.0"} {
+		if _, _, err := ParseReturnCode(code); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Expected %q to be rejected, actual %v", code, err)
+		}
+	}
+}
+
+func TestWithAnswerInterpreter(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{
+		// The list answers with the queried IP, setting the high bit of the last octet for listings.
+		"1.2.0.192.dnsbl.example.org.": {"192.0.2.129"},
+		"2.2.0.192.dnsbl.example.org.": {"192.0.2.2"},
+	}}
+
+	interpret := func(queried net.IP, answer net.IP) (bool, string) {
+		q, a := queried.To4(), answer.To4()
+		if q == nil || a == nil || !q[:3].Equal(a[:3]) || a[3]&0x80 == 0 {
+			return false, ""
+		}
+
+		return true, "flagged"
+	}
+
+	res := NewRBL("dnsbl.example.org", true, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if res.IsListed() || !errors.Is(res.Results[0].ErrorType, ErrUnexpectedAnswer) {
+		t.Errorf("Expected the answer to be rejected by default, actual %+v", res.Results)
+	}
+
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithAnswerInterpreter(interpret))
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if r := res.Results[0]; !r.Listed || r.Error || r.ListedAddress != "192.0.2.129" || r.Reason != "flagged" {
+		t.Errorf("Expected the interpreted listing, actual %+v", r)
+	}
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.2"))
+	if r := res.Results[0]; r.Listed || r.Error {
+		t.Errorf("Expected an interpreted not-listed result, actual %+v", r)
+	}
+}
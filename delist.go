@@ -0,0 +1,94 @@
+package gorbl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DelistingStatus describes the lists an IP remains on, or that couldn't confirm its removal.
+type DelistingStatus struct {
+	// Address is the IP that was checked
+	Address string `json:"address"`
+	// ListedOn holds the (non-whitelist) lists still listing the IP, in list order
+	ListedOn []string `json:"listed_on"`
+	// Unanswered holds the lists that failed to answer, so couldn't confirm the IP's removal
+	Unanswered []string `json:"unanswered"`
+}
+
+// DelistingReport is the outcome of checking that IPs have been removed from the lists (see VerifyDelisted).
+type DelistingReport struct {
+	// Checked is the number of IPs checked
+	Checked int `json:"checked"`
+	// StillListed holds the IPs still listed on at least one list, in the order they were supplied
+	StillListed []DelistingStatus `json:"still_listed"`
+	// Unverified holds the IPs no list answered as listed, but that some lists failed to answer for
+	Unverified []DelistingStatus `json:"unverified"`
+}
+
+// Delisted returns true if every IP checked was confirmed to be no longer listed.
+func (r DelistingReport) Delisted() bool {
+	return len(r.StillListed) == 0 && len(r.Unverified) == 0
+}
+
+/*
+String returns a report of the remaining listings, such as
+"1/3 IPs still listed: 192.0.2.1 (a.example.org, b.example.org)" or "3/3 IPs delisted".
+IPs that couldn't be confirmed are noted (i.e. "; 1 unverified: 192.0.2.2 (c.example.org unanswered)").
+*/
+func (r DelistingReport) String() string {
+	var b strings.Builder
+
+	if len(r.StillListed) == 0 {
+		fmt.Fprintf(&b, "%d/%d IPs delisted", r.Checked-len(r.Unverified), r.Checked)
+	} else {
+		entries := make([]string, 0, len(r.StillListed))
+		for _, status := range r.StillListed {
+			entries = append(entries, fmt.Sprintf("%s (%s)", status.Address, strings.Join(status.ListedOn, ", ")))
+		}
+		fmt.Fprintf(&b, "%d/%d IPs still listed: %s", len(r.StillListed), r.Checked, strings.Join(entries, "; "))
+	}
+
+	if len(r.Unverified) > 0 {
+		entries := make([]string, 0, len(r.Unverified))
+		for _, status := range r.Unverified {
+			entries = append(entries, fmt.Sprintf("%s (%s unanswered)", status.Address, strings.Join(status.Unanswered, ", ")))
+		}
+		fmt.Fprintf(&b, "; %d unverified: %s", len(r.Unverified), strings.Join(entries, "; "))
+	}
+
+	return b.String()
+}
+
+/*
+VerifyDelisted checks each of the supplied IPs, such as those removal was requested for, is
+no longer listed on any of the lists, reporting the listings that remain. Whitelists are
+ignored. IPs some lists failed to answer for are reported as unverified rather than delisted.
+*/
+func (m *MultiRBL) VerifyDelisted(ctx context.Context, ips []net.IP) DelistingReport {
+	report := DelistingReport{Checked: len(ips)}
+
+	for _, ip := range ips {
+		status := DelistingStatus{Address: ip.String()}
+
+		for _, rr := range m.LookupIP(ctx, ip) {
+			switch {
+			case rr.Whitelist:
+			case rr.IsListed():
+				status.ListedOn = append(status.ListedOn, rr.List)
+			case abstained(rr):
+				status.Unanswered = append(status.Unanswered, rr.List)
+			}
+		}
+
+		switch {
+		case len(status.ListedOn) > 0:
+			report.StillListed = append(report.StillListed, status)
+		case len(status.Unanswered) > 0:
+			report.Unverified = append(report.Unverified, status)
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,50 @@
+package gorbl
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestVerifyDelisted(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{
+			"1.2.0.192.a.example.org.": {"127.0.0.2"},
+			"1.2.0.192.b.example.org.": {"127.0.0.2"},
+			"3.2.0.192.w.example.org.": {"127.0.0.2"},
+		},
+		errs: map[string]error{"2.2.0.192.b.example.org.": &net.DNSError{Err: "i/o timeout", IsTimeout: true}},
+	}
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(mock)),
+		NewRBL("b.example.org", false, WithResolver(mock)),
+		NewRBL("w.example.org", false, WithResolver(mock), AsWhitelist()),
+	})
+
+	report := m.VerifyDelisted(context.Background(), []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.3")})
+	expected := DelistingReport{
+		Checked:     3,
+		StillListed: []DelistingStatus{{Address: "192.0.2.1", ListedOn: []string{"a.example.org", "b.example.org"}}},
+		Unverified:  []DelistingStatus{{Address: "192.0.2.2", Unanswered: []string{"b.example.org"}}},
+	}
+
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Expected %+v, actual %+v", expected, report)
+	}
+
+	if report.Delisted() {
+		t.Errorf("Expected the report not to confirm delisting")
+	}
+
+	if s := report.String(); s != "1/3 IPs still listed: 192.0.2.1 (a.example.org, b.example.org); 1 unverified: 192.0.2.2 (b.example.org unanswered)" {
+		t.Errorf("Unexpected report %q", s)
+	}
+
+	report = m.VerifyDelisted(context.Background(), []net.IP{net.ParseIP("192.0.2.3"), net.ParseIP("192.0.2.4")})
+	if !report.Delisted() || report.String() != "2/2 IPs delisted" {
+		t.Errorf("Expected every IP to be delisted, actual %+v (%s)", report, report)
+	}
+}
@@ -0,0 +1,92 @@
+package gorbl
+
+/*
+Listing identifies a single positive listing: an address listed on a zone of a list.
+*/
+type Listing struct {
+	// List is the RBL that listed the address
+	List string `json:"list"`
+	// Zone is the DNS zone that listed the address
+	Zone string `json:"zone"`
+	// Address is the IP address that was listed
+	Address string `json:"address"`
+	// ListedAddress is the address returned by the RBL for the listing
+	ListedAddress string `json:"listed_address"`
+}
+
+/*
+Delta holds the changes in listings between two scans.
+*/
+type Delta struct {
+	// Added are the listings present in the current scan but not the previous one
+	Added []Listing `json:"added"`
+	// Removed are the listings present in the previous scan but not the current one
+	Removed []Listing `json:"removed"`
+}
+
+/*
+Diff compares two scans, returning the listings which were added and removed between them.
+Added listings are returned in the order they appear in current, and removed listings in the
+order they appear in previous.
+*/
+func Diff(previous []RBLResults, current []RBLResults) Delta {
+	prev := listings(previous)
+	cur := listings(current)
+
+	prevSet := make(map[Listing]bool, len(prev))
+	for _, l := range prev {
+		prevSet[l] = true
+	}
+
+	curSet := make(map[Listing]bool, len(cur))
+	for _, l := range cur {
+		curSet[l] = true
+	}
+
+	delta := Delta{
+		Added:   []Listing{},
+		Removed: []Listing{},
+	}
+
+	for _, l := range cur {
+		if !prevSet[l] {
+			delta.Added = append(delta.Added, l)
+		}
+	}
+
+	for _, l := range prev {
+		if !curSet[l] {
+			delta.Removed = append(delta.Removed, l)
+		}
+	}
+
+	return delta
+}
+
+// listings returns the unique positive listings contained in the supplied results, in order.
+func listings(results []RBLResults) []Listing {
+	var ret []Listing
+	seen := map[Listing]bool{}
+
+	for _, rr := range results {
+		for _, res := range rr.Results {
+			if !res.Listed {
+				continue
+			}
+
+			l := Listing{
+				List:          rr.List,
+				Zone:          res.Zone,
+				Address:       res.Address,
+				ListedAddress: res.ListedAddress,
+			}
+
+			if !seen[l] {
+				seen[l] = true
+				ret = append(ret, l)
+			}
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,47 @@
+package gorbl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	previous := []RBLResults{
+		{List: "a.example.org", Results: []Result{
+			{Address: "192.0.2.1", Zone: "a.example.org", Listed: true, ListedAddress: "127.0.0.2"},
+			{Address: "192.0.2.2", Zone: "a.example.org", Listed: true, ListedAddress: "127.0.0.2"},
+		}},
+	}
+	current := []RBLResults{
+		{List: "a.example.org", Results: []Result{
+			{Address: "192.0.2.1", Zone: "a.example.org", Listed: true, ListedAddress: "127.0.0.2"},
+			{Address: "192.0.2.2", Zone: "a.example.org", Listed: false},
+		}},
+		{List: "b.example.org", Results: []Result{
+			{Address: "192.0.2.1", Zone: "b.example.org", Listed: true, ListedAddress: "127.0.0.4"},
+		}},
+	}
+
+	delta := Diff(previous, current)
+
+	expectedAdded := []Listing{{List: "b.example.org", Zone: "b.example.org", Address: "192.0.2.1", ListedAddress: "127.0.0.4"}}
+	if !reflect.DeepEqual(delta.Added, expectedAdded) {
+		t.Errorf("Expected added %v, actual %v", expectedAdded, delta.Added)
+	}
+
+	expectedRemoved := []Listing{{List: "a.example.org", Zone: "a.example.org", Address: "192.0.2.2", ListedAddress: "127.0.0.2"}}
+	if !reflect.DeepEqual(delta.Removed, expectedRemoved) {
+		t.Errorf("Expected removed %v, actual %v", expectedRemoved, delta.Removed)
+	}
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	t.Parallel()
+	scan := []RBLResults{{List: "a.example.org", Results: []Result{{Address: "192.0.2.1", Listed: true, ListedAddress: "127.0.0.2"}}}}
+
+	delta := Diff(scan, scan)
+	if len(delta.Added) != 0 || len(delta.Removed) != 0 {
+		t.Errorf("Expected no changes, actual %+v", delta)
+	}
+}
@@ -0,0 +1,154 @@
+package gorbl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+)
+
+// MXResolver is implemented by resolvers able to look up MX records, such as net.Resolver.
+type MXResolver interface {
+	// LookupMX returns the MX records of the supplied domain.
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+var _ MXResolver = (*net.Resolver)(nil)
+
+/*
+WithDomainLists sets the domain (RHSBL) lists LookupEmail checks the sender's domain against.
+The domain is looked up using each list's LookupEncoded, so *RBL lists should be configured
+with DomainEncoder (the DefaultEncoder also encodes domains).
+*/
+func WithDomainLists(lists ...EncodedLookuper) MultiOption {
+	return func(m *MultiRBL) {
+		var lookupers []Lookuper
+		for _, l := range lists {
+			lookupers = append(lookupers, l)
+		}
+
+		m.domainLists = NewMultiRBL(lookupers)
+	}
+}
+
+// WithMXResolver sets the resolver LookupEmail uses to find the sender domain's MX hosts; a net.Resolver is used if not set.
+func WithMXResolver(resolver MXResolver) MultiOption {
+	return func(m *MultiRBL) {
+		m.mxResolver = resolver
+	}
+}
+
+/*
+EmailResults holds the results of checking the reputation of an email sender.
+*/
+type EmailResults struct {
+	// Address is the email address that was checked
+	Address string `json:"address"`
+	// Domain is the domain of the address
+	Domain string `json:"domain"`
+	// Hosts are the hosts whose IPs were checked: the domain's MX hosts, along with the domain itself
+	Hosts []string `json:"hosts"`
+	// IPResults holds the results of the IP lists, one RBLResults per list covering every host
+	IPResults []RBLResults `json:"ip_results"`
+	// DomainResults holds the results of the domain lists, one RBLResults per list
+	DomainResults []RBLResults `json:"domain_results"`
+	// Reputation summarizes every IP and domain result using DefaultPolicy
+	Reputation Reputation `json:"reputation"`
+}
+
+/*
+LookupEmail checks the reputation of the sender of the supplied email address (i.e.
+"user@example.com" or "User <user@example.com>"). The IPs of the domain and its MX hosts
+are looked up in the MultiRBL's lists (with one RBLResults per list), and the domain itself in the lists configured using
+WithDomainLists. An error is returned if the address can't be parsed or the MX lookup fails;
+a domain without MX records is checked on its own.
+*/
+func (m *MultiRBL) LookupEmail(ctx context.Context, address string) (EmailResults, error) {
+	domain, err := emailDomain(address)
+	if err != nil {
+		return EmailResults{}, err
+	}
+
+	ret := EmailResults{
+		Address: address,
+		Domain:  domain,
+		Hosts:   []string{domain},
+	}
+
+	resolver := m.mxResolver
+	if resolver == nil {
+		resolver = &net.Resolver{}
+	}
+
+	mxs, err := resolver.LookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return ret, err
+	}
+
+	for _, mx := range mxs {
+		host := strings.ToLower(strings.TrimSuffix(mx.Host, "."))
+		// A null MX (RFC 7505) indicates the domain doesn't accept mail.
+		if len(host) > 0 && host != domain {
+			ret.Hosts = append(ret.Hosts, host)
+		}
+	}
+
+	// Each list is reported once, however many hosts were looked up in it, so Evaluate counts it once.
+	ret.IPResults, _ = m.fanOut(ctx, nil, func(ctx context.Context, l Lookuper) RBLResults {
+		var merged RBLResults
+		for i, host := range ret.Hosts {
+			rr := l.Lookup(ctx, host)
+			if i == 0 {
+				merged = rr
+				merged.Host, merged.HostASCII, merged.Results = domain, "", nil
+			}
+
+			merged.Incomplete = merged.Incomplete || rr.Incomplete
+			merged.Results = appendUnsearched(merged.Results, rr.Results)
+		}
+
+		return merged
+	})
+
+	if m.domainLists != nil {
+		ret.DomainResults, _ = m.domainLists.fanOut(ctx, nil, func(ctx context.Context, l Lookuper) RBLResults {
+			// Every domain list is an EncodedLookuper (see WithDomainLists).
+			return l.(EncodedLookuper).LookupEncoded(ctx, domain)
+		})
+	}
+
+	ret.Reputation = Evaluate(append(append([]RBLResults(nil), ret.IPResults...), ret.DomainResults...), nil)
+	return ret, nil
+}
+
+// appendUnsearched appends the results for the addresses (and zones) not already in results, for IPs shared by several hosts.
+func appendUnsearched(results []Result, more []Result) []Result {
+	for _, res := range more {
+		searched := false
+		for _, existing := range results {
+			searched = searched || (existing.Address == res.Address && existing.Zone == res.Zone)
+		}
+
+		if !searched {
+			results = append(results, res)
+		}
+	}
+
+	return results
+}
+
+// emailDomain returns the lowercase domain of the supplied email address.
+func emailDomain(address string) (string, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q is not an email address", ErrInvalidInput, address)
+	}
+
+	at := strings.LastIndex(parsed.Address, "@")
+	if at < 0 || at == len(parsed.Address)-1 {
+		return "", fmt.Errorf("%w: %q has no domain", ErrInvalidInput, address)
+	}
+
+	return strings.ToLower(strings.TrimSuffix(parsed.Address[at+1:], ".")), nil
+}
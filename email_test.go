@@ -0,0 +1,127 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// mockMXResolver answers MX lookups from a static map.
+type mockMXResolver map[string][]*net.MX
+
+func (m mockMXResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if mxs, ok := m[name]; ok {
+		return mxs, nil
+	}
+
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func TestMultiRBLLookupEmail(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		ips: map[string][]net.IPAddr{
+			"example.com":    {{IP: net.IPv4(192, 0, 2, 1)}},
+			"mx.example.com": {{IP: net.IPv4(192, 0, 2, 25)}},
+		},
+		hosts: map[string][]string{
+			"25.2.0.192.dnsbl.example.org.": {"127.0.0.2"},
+			"example.com.dbl.example.org.":  {"127.0.1.2"},
+		},
+	}
+	mx := mockMXResolver{"example.com": {{Host: "MX.example.com.", Pref: 10}}}
+
+	m := NewMultiRBL(
+		[]Lookuper{NewRBL("dnsbl.example.org", false, WithResolver(mock))},
+		WithDomainLists(NewRBL("dbl.example.org", false, WithResolver(mock), WithEncoder(DomainEncoder))),
+		WithMXResolver(mx),
+	)
+
+	res, err := m.LookupEmail(context.Background(), "User <user@Example.com>")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if res.Domain != "example.com" || len(res.Hosts) != 2 || res.Hosts[1] != "mx.example.com" {
+		t.Errorf("Expected the domain and its MX host, actual %+v", res)
+	}
+
+	if len(res.IPResults) != 1 || len(res.IPResults[0].Results) != 2 || res.IPResults[0].Results[0].Listed || !res.IPResults[0].Results[1].Listed {
+		t.Errorf("Expected a single list result with only the MX host listed, actual %+v", res.IPResults)
+	}
+
+	if len(res.DomainResults) != 1 || !res.DomainResults[0].IsListed() {
+		t.Errorf("Expected the domain to be listed, actual %+v", res.DomainResults)
+	}
+
+	if res.Reputation.ListsHit != 2 || res.Reputation.Verdict != Block {
+		t.Errorf("Expected two hits and a block, actual %+v", res.Reputation)
+	}
+}
+
+func TestMultiRBLLookupEmailSharedIP(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		ips: map[string][]net.IPAddr{
+			"example.com":    {{IP: net.IPv4(192, 0, 2, 1)}},
+			"mx.example.com": {{IP: net.IPv4(192, 0, 2, 1)}},
+		},
+		hosts: map[string][]string{"1.2.0.192.dnsbl.example.org.": {"127.0.0.2"}},
+	}
+	mx := mockMXResolver{"example.com": {{Host: "mx.example.com.", Pref: 10}}}
+
+	m := NewMultiRBL([]Lookuper{NewRBL("dnsbl.example.org", false, WithResolver(mock))}, WithMXResolver(mx))
+
+	res, err := m.LookupEmail(context.Background(), "user@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(res.IPResults) != 1 || len(res.IPResults[0].Results) != 1 {
+		t.Errorf("Expected the shared IP to be reported once, actual %+v", res.IPResults)
+	}
+
+	// The list is only counted once, however many hosts it lists.
+	if res.Reputation.ListsQueried != 1 || res.Reputation.ListsHit != 1 || len(res.Reputation.ListedOn) != 1 {
+		t.Errorf("Expected a single list hit, actual %+v", res.Reputation)
+	}
+}
+
+func TestMultiRBLLookupEmailInvalid(t *testing.T) {
+	t.Parallel()
+	m := NewMultiRBL(nil, WithMXResolver(mockMXResolver{}))
+
+	for _, address := range []string{"", "not an address", "user@"} {
+		if _, err := m.LookupEmail(context.Background(), address); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Expected %q to be rejected, actual %v", address, err)
+		}
+	}
+
+	// A domain without MX records is checked on its own.
+	res, err := m.LookupEmail(context.Background(), "user@example.net")
+	if err != nil || len(res.Hosts) != 1 || res.Hosts[0] != "example.net" {
+		t.Errorf("Expected only the domain to be checked, actual %+v (%v)", res, err)
+	}
+}
+
+func TestMultiRBLLookupEmailFakeDomainList(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{ips: map[string][]net.IPAddr{"example.com": {{IP: net.IPv4(192, 0, 2, 1)}}}}
+
+	m := NewMultiRBL(
+		[]Lookuper{NewRBL("dnsbl.example.org", false, WithResolver(mock))},
+		WithDomainLists(&fakeLookuper{list: "dbl.example.org", listed: map[string]bool{"example.com": true}}),
+		WithMXResolver(mockMXResolver{}),
+	)
+
+	res, err := m.LookupEmail(context.Background(), "user@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(res.DomainResults) != 1 || res.DomainResults[0].List != "dbl.example.org" || !res.DomainResults[0].IsListed() {
+		t.Errorf("Expected the fake domain list to report the domain, actual %+v", res.DomainResults)
+	}
+}
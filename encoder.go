@@ -0,0 +1,128 @@
+package gorbl
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+/*
+Encoder converts the input of a lookup (an IP address or domain, for example) into the
+label prepended to the RBL zone. Encoders allow lists using non-standard label schemes
+to be queried; one can be configured per RBL using WithEncoder.
+*/
+type Encoder interface {
+	// Encode returns the label to query for the supplied input.
+	Encode(input string) (label string, err error)
+}
+
+// EncoderFunc adapts an ordinary function to the Encoder interface.
+type EncoderFunc func(input string) (string, error)
+
+// Encode calls f(input).
+func (f EncoderFunc) Encode(input string) (string, error) {
+	return f(input)
+}
+
+var (
+	// IPv4Encoder encodes IPv4 addresses as their reversed octets (192.0.2.1 becomes 1.2.0.192).
+	IPv4Encoder Encoder = EncoderFunc(encodeIPv4)
+	// IPv6Encoder encodes IPv6 addresses as their reversed nibbles, per RFC 5782.
+	IPv6Encoder Encoder = EncoderFunc(encodeIPv6)
+	// DomainEncoder encodes domains (for RHSBL style lists) in lowercase without a trailing dot.
+	DomainEncoder Encoder = EncoderFunc(encodeDomain)
+	// DefaultEncoder dispatches IPv4 and IPv6 addresses and domains to the matching encoder above.
+	DefaultEncoder Encoder = EncoderFunc(encodeDefault)
+)
+
+/*
+ReverseIPv6 expands a given IPv6 address into its reversed nibbles
+2001:db8::1 becomes 1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2
+*/
+func ReverseIPv6(ip net.IP) string {
+	ip16 := ip.To16()
+	if ip16 == nil || ip.To4() != nil {
+		return ""
+	}
+
+	return ReverseBytes16([16]byte(ip16))
+}
+
+/*
+ReverseBytes4 returns the reversed query label for an IPv4 address stored as a byte array,
+avoiding the allocations of going through net.IP. {192, 0, 2, 1} becomes 1.2.0.192.
+*/
+func ReverseBytes4(ip [4]byte) string {
+	buf := make([]byte, 0, len("255.255.255.255"))
+	for i := len(ip) - 1; i >= 0; i-- {
+		buf = strconv.AppendUint(buf, uint64(ip[i]), 10)
+		if i > 0 {
+			buf = append(buf, '.')
+		}
+	}
+
+	return string(buf)
+}
+
+/*
+ReverseBytes16 returns the reversed nibble query label for an IPv6 address stored as a byte
+array, avoiding the allocations of going through net.IP. IPv4-mapped addresses are expanded
+as-is; use ReverseBytes4 to query them as IPv4.
+*/
+func ReverseBytes16(ip [16]byte) string {
+	const hexDigits = "0123456789abcdef"
+
+	var buf [63]byte
+	for i, b := range ip {
+		// The last byte of the address is written first, low nibble leading.
+		pos := (len(ip) - 1 - i) * 4
+		buf[pos] = hexDigits[b&0x0f]
+		buf[pos+2] = hexDigits[b>>4]
+		buf[pos+1] = '.'
+		if pos+3 < len(buf) {
+			buf[pos+3] = '.'
+		}
+	}
+
+	return string(buf[:])
+}
+
+func encodeIPv4(input string) (string, error) {
+	ip := net.ParseIP(input)
+	if ip == nil || ip.To4() == nil {
+		return "", fmt.Errorf("%w: %q is not an IPv4 address", ErrInvalidInput, input)
+	}
+
+	return Reverse(ip), nil
+}
+
+func encodeIPv6(input string) (string, error) {
+	ip := net.ParseIP(input)
+	if ip == nil || ip.To4() != nil {
+		return "", fmt.Errorf("%w: %q is not an IPv6 address", ErrInvalidInput, input)
+	}
+
+	return ReverseIPv6(ip), nil
+}
+
+func encodeDomain(input string) (string, error) {
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(input), "."))
+	if len(domain) == 0 || net.ParseIP(domain) != nil {
+		return "", fmt.Errorf("%w: %q is not a domain", ErrInvalidInput, input)
+	}
+
+	return domain, nil
+}
+
+func encodeDefault(input string) (string, error) {
+	if ip := net.ParseIP(input); ip != nil {
+		if ip.To4() != nil {
+			return encodeIPv4(input)
+		}
+
+		return encodeIPv6(input)
+	}
+
+	return encodeDomain(input)
+}
@@ -0,0 +1,103 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestReverseIPv6(t *testing.T) {
+	t.Parallel()
+	r := ReverseIPv6(net.ParseIP("2001:db8::1"))
+
+	expected := "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2"
+	if r != expected {
+		t.Errorf("Expected %s, actual %s", expected, r)
+	}
+
+	if r := ReverseIPv6(net.ParseIP("192.0.2.1")); r != "" {
+		t.Errorf("Expected IPv4 to be rejected, actual %s", r)
+	}
+}
+
+func TestReverseBytes(t *testing.T) {
+	t.Parallel()
+	if r := ReverseBytes4([4]byte{192, 0, 2, 1}); r != "1.2.0.192" {
+		t.Errorf("Expected 1.2.0.192, actual %s", r)
+	}
+
+	if r := ReverseBytes4([4]byte{255, 10, 0, 7}); r != "7.0.10.255" {
+		t.Errorf("Expected 7.0.10.255, actual %s", r)
+	}
+
+	ip := net.ParseIP("2001:db8::1")
+	if r := ReverseBytes16([16]byte(ip)); r != ReverseIPv6(ip) {
+		t.Errorf("Expected %s, actual %s", ReverseIPv6(ip), r)
+	}
+}
+
+func TestBuiltinEncoders(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		encoder  Encoder
+		input    string
+		expected string
+	}{
+		{IPv4Encoder, "192.0.2.1", "1.2.0.192"},
+		{IPv6Encoder, "2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2"},
+		{DomainEncoder, "Example.COM.", "example.com"},
+		{DefaultEncoder, "192.0.2.1", "1.2.0.192"},
+		{DefaultEncoder, "example.com", "example.com"},
+	}
+
+	for _, c := range cases {
+		label, err := c.encoder.Encode(c.input)
+		if err != nil || label != c.expected {
+			t.Errorf("Expected %s for %s, actual %s (%v)", c.expected, c.input, label, err)
+		}
+	}
+
+	for _, bad := range []struct {
+		encoder Encoder
+		input   string
+	}{
+		{IPv4Encoder, "2001:db8::1"},
+		{IPv6Encoder, "192.0.2.1"},
+		{DomainEncoder, ""},
+	} {
+		if _, err := bad.encoder.Encode(bad.input); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Expected ErrInvalidInput for %q, actual %v", bad.input, err)
+		}
+	}
+}
+
+func TestLookupIPCustomEncoder(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"custom.dnsbl.example.org.": {"127.0.0.2"}},
+	}
+	encoder := EncoderFunc(func(string) (string, error) { return "custom", nil })
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithEncoder(encoder))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if len(res.Results) != 1 || !res.Results[0].Listed {
+		t.Errorf("Expected the custom label to be queried, actual %+v", res.Results)
+	}
+}
+
+func TestLookupEncodedError(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithEncoder(IPv4Encoder))
+
+	res := rbl.LookupEncoded(context.Background(), "example.com")
+	if len(res.Results) != 1 || !errors.Is(res.Results[0].ErrorType, ErrInvalidInput) {
+		t.Errorf("Expected an ErrInvalidInput result, actual %+v", res.Results)
+	}
+
+	if len(mock.hostQueries) != 0 {
+		t.Errorf("Expected no queries, actual %v", mock.hostQueries)
+	}
+}
@@ -0,0 +1,132 @@
+package gorbl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrInvalidInput is reported when a lookup's input can't be encoded into a query label.
+var ErrInvalidInput = errors.New("gorbl: invalid input")
+
+// ErrExchangerRequired is returned by methods needing exchange details when the RBL's resolver isn't an Exchanger.
+var ErrExchangerRequired = errors.New("gorbl: resolver must be an Exchanger (i.e. a Client)")
+
+// ErrEmptyHost is reported when Lookup is passed an empty (or whitespace-only) host.
+var ErrEmptyHost = errors.New("gorbl: host must not be empty")
+
+// ErrUnexpectedAnswer is reported when an RBL returns an address outside its listing range.
+var ErrUnexpectedAnswer = errors.New("gorbl: address outside the listing range")
+
+// ErrSentinelNotListed is returned by Ping when the RBL answers without listing its sentinel address.
+var ErrSentinelNotListed = errors.New("gorbl: sentinel address not listed")
+
+// ErrResolverUnhealthy is returned by ResolverHealthy when the RBL's resolver fails to resolve the control name.
+var ErrResolverUnhealthy = errors.New("gorbl: resolver unhealthy")
+
+// ErrCNAMELoop is reported when the CNAME records answering a query form a loop.
+var ErrCNAMELoop = errors.New("gorbl: CNAME loop")
+
+// ErrCNAMEDepth is reported when the CNAME records answering a query exceed the configured depth (see Client.MaxCNAMEDepth).
+var ErrCNAMEDepth = errors.New("gorbl: CNAME chain too long")
+
+// ErrQueueFull is returned by Queue.TrySubmit when the queue has no room for the submission.
+var ErrQueueFull = errors.New("gorbl: queue full")
+
+// ErrQueueClosed is returned when submitting to a Queue that has been closed.
+var ErrQueueClosed = errors.New("gorbl: queue closed")
+
+// ErrNameTooLong is reported when a query name would exceed the DNS name or label length limits.
+var ErrNameTooLong = errors.New("gorbl: query name too long")
+
+/*
+ServerFailureError is reported by a Client detecting DNSSEC failures (see
+Client.DetectDNSSECFailures) when a nameserver answers SERVFAIL.
+*/
+type ServerFailureError struct {
+	// Name is the name that was queried
+	Name string
+	// Server is the nameserver that answered
+	Server string
+	// DNSSECFailure indicates the failure was caused by DNSSEC validation: the server answered
+	// once asked not to validate, so the zone's signatures (or the server's trust anchors) are broken.
+	DNSSECFailure bool
+}
+
+// Error describes the failure.
+func (e *ServerFailureError) Error() string {
+	if e.DNSSECFailure {
+		return fmt.Sprintf("lookup %s on %s: DNSSEC validation failure", e.Name, e.Server)
+	}
+
+	return fmt.Sprintf("lookup %s on %s: server misbehaving", e.Name, e.Server)
+}
+
+// Temporary returns true; server failures are assumed transient, as with net.DNSError.
+func (e *ServerFailureError) Temporary() bool {
+	return true
+}
+
+// ListError is a failed query against a single list, as held by a MultiError.
+type ListError struct {
+	// List is the RBL the query failed against
+	List string
+	// Address is the IP that was searched
+	Address string
+	// Err is the failure
+	Err error
+}
+
+// Error describes the list and its failure.
+func (e *ListError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.List, e.Address, e.Err)
+}
+
+// Unwrap returns the failure.
+func (e *ListError) Unwrap() error {
+	return e.Err
+}
+
+/*
+MultiError aggregates the failed queries of a MultiRBL lookup (see WithAggregatedErrors).
+Like errors.Join, it implements Unwrap() []error, so errors.Is and errors.As inspect each failure.
+*/
+type MultiError struct {
+	// Errors holds one ListError per failed query, in list order
+	Errors []*ListError
+}
+
+// Error lists every failure.
+func (e *MultiError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("gorbl: %d list(s) failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the individual failures.
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// isNotFound returns true if the supplied error indicates the queried name doesn't exist (NXDOMAIN).
+func isNotFound(err error) bool {
+	var (
+		dnsErr     *net.DNSError
+		decodedErr *decodedError
+	)
+
+	if errors.As(err, &decodedErr) {
+		return decodedErr.notFound
+	}
+
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,91 @@
+package gorbl
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+/*
+FailureMode dictates how an RBL reports queries that failed (timeouts, server failures,
+query errors, etc.; see Result.Failed). An IP the RBL answered as not listed (NXDOMAIN)
+is never affected.
+
+The choice is a tradeoff between availability and security: failing open keeps legitimate
+traffic flowing when a list is unreachable, but lets listed hosts through for as long as the
+outage (or an attacker's interference with DNS) lasts. Failing closed blocks those hosts but
+also rejects everyone else when a list goes down.
+*/
+type FailureMode int
+
+const (
+	// FailOpen reports failed queries as not listed, treating the IP as clean. This is the default.
+	FailOpen FailureMode = iota
+	// FailClosed reports failed queries on non-whitelist RBLs as listed, treating the IP as abusive.
+	// Whitelists are unaffected, so a failure never causes a host to be trusted.
+	FailClosed
+)
+
+// applyFailureMode updates the supplied results according to the RBL's failure mode.
+func (r *RBL) applyFailureMode(results []Result) []Result {
+	if r.failureMode != FailClosed || r.whitelist {
+		return results
+	}
+
+	for i := range results {
+		// Error remains set, so callers can still tell these results apart from genuine listings.
+		if results[i].Failed() {
+			results[i].Listed = true
+		}
+	}
+
+	return results
+}
+
+/*
+ServFailHandling dictates how an RBL handles SERVFAIL answers. A SERVFAIL may be transient
+(i.e. an overloaded server) or persistent (i.e. a broken zone); some providers routinely
+answer SERVFAIL under load, so the handling is configured per RBL (see WithServFailHandling).
+*/
+type ServFailHandling int
+
+const (
+	// ServFailUnknown reports a SERVFAIL immediately as a failed result, leaving the IP's status unknown. This is the default.
+	ServFailUnknown ServFailHandling = iota
+	// ServFailRetry repeats the query up to ServFailRetries times before reporting a failed result.
+	ServFailRetry
+)
+
+// ServFailRetries is the number of times a query is repeated after a SERVFAIL answer when retrying.
+const ServFailRetries = 2
+
+/*
+lookupHostRetrying performs the A lookup of the supplied name, repeating it after SERVFAIL
+answers if the RBL retries them.
+*/
+func (r *RBL) lookupHostRetrying(ctx context.Context, name string) (answer, error) {
+	ans, err := r.lookupHost(ctx, name)
+	if r.servFail != ServFailRetry {
+		return ans, err
+	}
+
+	for attempt := 0; attempt < ServFailRetries && isServerFailure(err) && ctx.Err() == nil; attempt++ {
+		ans, err = r.lookupHost(ctx, name)
+	}
+
+	return ans, err
+}
+
+/*
+isServerFailure returns true if the supplied error reports a SERVFAIL answer. DNSSEC
+validation failures detected by a Client are persistent, so aren't included.
+*/
+func isServerFailure(err error) bool {
+	var sfErr *ServerFailureError
+	if errors.As(err, &sfErr) {
+		return !sfErr.DNSSECFailure
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.Err == "server misbehaving"
+}
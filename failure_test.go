@@ -0,0 +1,110 @@
+package gorbl
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestFailureMode(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		errs: map[string]error{"1.2.0.192.dnsbl.example.org.": &net.DNSError{Err: "server misbehaving", IsTemporary: true}},
+	}
+
+	cases := []struct {
+		ip     string
+		opts   []Option
+		listed bool
+	}{
+		{"192.0.2.1", nil, false},
+		{"192.0.2.1", []Option{WithFailureMode(FailOpen)}, false},
+		{"192.0.2.1", []Option{WithFailureMode(FailClosed)}, true},
+		{"192.0.2.1", []Option{WithFailureMode(FailClosed), AsWhitelist()}, false},
+		// NXDOMAIN is an answer rather than a failure.
+		{"192.0.2.2", []Option{WithFailureMode(FailClosed)}, false},
+	}
+
+	for _, c := range cases {
+		rbl := NewRBL("dnsbl.example.org", false, append(c.opts, WithResolver(mock))...)
+		res := rbl.LookupIP(context.Background(), net.ParseIP(c.ip))
+
+		if len(res.Results) != 1 || res.Results[0].Listed != c.listed || !res.Results[0].Error {
+			t.Errorf("Expected listed=%t with an error for %s, actual %+v", c.listed, c.ip, res.Results)
+		}
+	}
+}
+
+// flakyResolver answers SERVFAIL for the first failures lookups of each name, then defers to the mockResolver.
+type flakyResolver struct {
+	*mockResolver
+	failures int
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (f *flakyResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	f.mu.Lock()
+	n := f.calls[host]
+	f.calls[host]++
+	f.mu.Unlock()
+
+	if n < f.failures {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+	}
+
+	return f.mockResolver.LookupHost(ctx, host)
+}
+
+func TestServFailHandling(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		handling ServFailHandling
+		failures int
+		listed   bool
+		queries  int
+	}{
+		{ServFailUnknown, 1, false, 1},
+		{ServFailRetry, 1, true, 2},
+		{ServFailRetry, ServFailRetries, true, ServFailRetries + 1},
+		{ServFailRetry, 10, false, ServFailRetries + 1},
+	}
+
+	for _, c := range cases {
+		flaky := &flakyResolver{
+			mockResolver: &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}},
+			failures:     c.failures,
+			calls:        map[string]int{},
+		}
+		rbl := NewRBL("dnsbl.example.org", false, WithResolver(flaky), WithServFailHandling(c.handling))
+
+		res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+		if res.IsListed() != c.listed || res.Results[0].Failed() == c.listed {
+			t.Errorf("Expected listed %t with handling %d after %d failures, actual %+v", c.listed, c.handling, c.failures, res.Results)
+		}
+
+		if n := flaky.calls["2.0.0.127.dnsbl.example.org."]; n != c.queries {
+			t.Errorf("Expected %d queries with handling %d, actual %d", c.queries, c.handling, n)
+		}
+	}
+}
+
+func TestServFailRetrySkipsOtherErrors(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{errs: map[string]error{
+		"1.2.0.192.dnsbl.example.org.": &ServerFailureError{Name: "1.2.0.192.dnsbl.example.org.", DNSSECFailure: true},
+		"2.2.0.192.dnsbl.example.org.": &net.DNSError{Err: "i/o timeout", IsTimeout: true},
+	}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithServFailHandling(ServFailRetry))
+
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.2"))
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.3"))
+
+	if c := mock.hostQueryCount(); c != 3 {
+		t.Errorf("Expected DNSSEC failures, timeouts and NXDOMAIN not to be retried, actual %d queries", c)
+	}
+}
@@ -6,8 +6,9 @@ This package takes inspiration from a similar module that I wrote in Python
 (https://github.com/polera/rblwatch).
 
 gorbl takes a simpler approach:  Basic lookup capability is provided by the
-lib.  Unlike in rblwatch, concurrent lookups and the lists to search are
-left to those using the lib.
+lib.  Unlike in rblwatch, the lists to search are left to those using the lib
+(DefaultLists offers a starting point), and MultiRBL is available to search
+several lists concurrently.
 
 JSON annotations on the types are provided as a convenience.
 */
@@ -17,22 +18,142 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/url"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/sync/singleflight"
 )
 
 /*
 RBL contains the lookup parameters for this blacklist.
+
+An RBL is safe for concurrent use by multiple goroutines. Its configuration is fixed once
+NewRBL returns, and any state shared between lookups must be synchronized.
 */
 type RBL struct {
 	// hostname is the DNS base to perform lookups against.
 	hostname string
+	// subZones are the optional zones beneath hostname to perform lookups against instead of hostname itself.
+	subZones []string
 	// lookupTXT dictates whether we will also perform a TXT lookup for this blacklist.
 	lookupTxt bool
+	// txtCodes optionally restricts TXT lookups to listings returning one of these addresses.
+	txtCodes map[string]bool
+	// whitelist indicates this list identifies trusted rather than abusive hosts.
+	whitelist bool
+	// failureMode dictates how failed queries are reported (see WithFailureMode).
+	failureMode FailureMode
+	// servFail dictates whether SERVFAIL answers are retried (see WithServFailHandling).
+	servFail ServFailHandling
+	// weight is the optional relative trust placed in the list (see WithWeight).
+	weight float64
+	// category is the optional kind of listing this list reports (see WithCategory).
+	category Category
 
 	// resolver is an internal DNS resolver we will use (allowing for context to be passed to DNS lookups).
-	resolver *net.Resolver
+	resolver Resolver
+
+	// labelPrefix is prepended to every query label.
+	labelPrefix string
+	// labelSeparator joins the query label and zone; a single dot is used if empty.
+	labelSeparator string
+	// encoder optionally overrides how lookup inputs are encoded into query labels.
+	encoder Encoder
+	// codeDecoder optionally translates listed addresses into sub-list names.
+	codeDecoder CodeDecoder
+	// scoreExtractor optionally interprets listed addresses as a numeric score.
+	scoreExtractor ScoreExtractor
+	// interpreter optionally decides whether returned addresses are listings, replacing the listing range checks.
+	interpreter AnswerInterpreter
+	// explanationZone is the optional parallel zone queried for the details of listings.
+	explanationZone string
+	// txtParser optionally extracts structured fields from TXT records.
+	txtParser TxtParser
+	// firstSeen optionally extracts the time listings were first seen from TXT records.
+	firstSeen FirstSeenExtractor
+	// timeout is the optional per-query timeout, applied only when the caller's context has no deadline.
+	timeout time.Duration
+	// aTimeout and txtTimeout optionally bound the A and TXT queries respectively, overriding timeout.
+	aTimeout   time.Duration
+	txtTimeout time.Duration
+	// jitter is the upper bound of the random delay inserted between batch queries.
+	jitter time.Duration
+	// mapTransition enables querying the IPv4 address embedded in IPv6 transition addresses.
+	mapTransition bool
+	// aaaa enables including AAAA answers from the zone alongside the A answers.
+	aaaa bool
+	// diagnostics enables recording the wire details of each exchange.
+	diagnostics bool
+	// responseMeta enables recording the DNS response details on each result.
+	responseMeta bool
+	// listingNets are the ranges returned addresses must fall in to be treated as listings; 127.0.0.0/8 if empty.
+	listingNets []net.IPNet
+	// removalURLTemplate is the optional delisting URL pattern recorded on listed results.
+	removalURLTemplate string
+	// skipUnqueryable makes LookupIP skip private and reserved IPs (see IsQueryable).
+	skipUnqueryable bool
+	// tracer is optionally invoked around each DNS query.
+	tracer Tracer
+	// logMask optionally masks the IPs in the query names reported to the tracer (see WithLogMasking).
+	logMask func(net.IP) net.IP
+	// overrides are the locally maintained verdicts answered by LookupIP instead of querying, keyed by IP.
+	overrides map[string]Override
+	// controlName is the known-good name ResolverHealthy resolves.
+	controlName string
+	// sentinel is the address Verify expects to be listed.
+	sentinel net.IP
+	// limiter optionally bounds the number of concurrent queries, possibly shared with other RBLs.
+	limiter *Limiter
+	// maxConcurrency optionally bounds the RBL's own concurrent queries, and the lookups LookupBatch runs at once.
+	maxConcurrency int
+	// listLimiter enforces maxConcurrency, beneath any shared limiter.
+	listLimiter *Limiter
+	// cacheTTL enables caching query results for the supplied duration (see WithCache).
+	cacheTTL time.Duration
+	// positiveTTL and negativeTTL optionally override cacheTTL for listings and other results respectively.
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	// cacheMaxEntries optionally bounds the number of cached queries.
+	cacheMaxEntries int
+	// staleWindow is how long past their TTL cached results are served while being refreshed.
+	staleWindow time.Duration
+	// cache holds the cached query results, if caching is enabled.
+	cache *resultCache
+	// inFlight shares concurrent identical queries, if deduplication is enabled.
+	inFlight *singleflight.Group
+	// budget is the optional cap on the total time spent by a single Lookup, LookupHostWithIPs or LookupBatch call.
+	budget time.Duration
+}
+
+/*
+Lookuper is implemented by anything able to perform RBL lookups. *RBL satisfies it;
+consumers can depend on Lookuper instead to substitute their own implementations (in tests, for example).
+*/
+type Lookuper interface {
+	// LookupIP looks up the specified IP and returns its response.
+	LookupIP(ctx context.Context, ip net.IP) RBLResults
+	// Lookup looks up the IPs tied to the specified hostname and returns the response.
+	Lookup(ctx context.Context, targetHost string) RBLResults
+}
+
+/*
+EncodedLookuper is implemented by lookupers able to look up an input (i.e. a domain) using
+their own encoding, as domain (RHSBL) lists do. *RBL satisfies it.
+*/
+type EncodedLookuper interface {
+	Lookuper
+	// LookupEncoded encodes the supplied input and looks up the resulting label.
+	LookupEncoded(ctx context.Context, input string) RBLResults
 }
 
+var (
+	_ Lookuper        = (*RBL)(nil)
+	_ EncodedLookuper = (*RBL)(nil)
+)
+
 /*
 RBLResults holds the results of the lookup.
 */
@@ -41,75 +162,543 @@ type RBLResults struct {
 	List string `json:"list"`
 	// Host is the host or IP that was passed (i.e. smtp.gmail.com)
 	Host string `json:"host"`
+	// HostASCII is the ASCII (punycode) form of Host that was resolved, set by Lookup
+	HostASCII string `json:"host_ascii"`
+	// Whitelist indicates the RBL that was searched is a whitelist
+	Whitelist bool `json:"whitelist"`
+	// Category is the kind of listing the RBL that was searched reports, if configured
+	Category Category `json:"category"`
+	// Weight is the relative trust placed in the RBL that was searched (see WithWeight); 0 if not configured
+	Weight float64 `json:"weight"`
+	// Incomplete indicates the lookup budget expired before the host was resolved or every IP was fully searched
+	Incomplete bool `json:"incomplete"`
 	// Results is a slice of Results - one per IP address searched
 	Results []Result `json:"results"`
 }
 
+// IsListed returns true if any of the results indicate a listing.
+func (r RBLResults) IsListed() bool {
+	for _, res := range r.Results {
+		if res.Listed {
+			return true
+		}
+	}
+
+	return false
+}
+
 /*
 Result holds the individual IP lookup results for each RBL search
 */
 type Result struct {
 	// Address is the IP address that was searched
 	Address string `json:"address"`
+	// MappedFrom is the IPv6 transition address Address was extracted from, if any
+	MappedFrom string `json:"mapped_from"`
+	// Zone is the DNS zone that was searched; this differs from the list when sub-zones are configured
+	Zone string `json:"zone"`
+	// QueriedName is the fully-qualified name that was queried (i.e. 1.2.0.192.dnsbl.example.org.)
+	QueriedName string `json:"queried_name"`
+	// ReportedBy holds every zone reporting this listing, when duplicates are collapsed by a MultiRBL
+	ReportedBy []string `json:"reported_by"`
+	// DuplicateOf is the zone first reporting this listing, when it is marked as a duplicate by a MultiRBL
+	DuplicateOf string `json:"duplicate_of"`
 	// Listed indicates whether or not the IP was on the RBL
 	Listed bool `json:"listed"`
 	// If the IP was listed, what address was returned?
 	// RBL lists sometimes use the returned IP to indicate why it was listed.
 	ListedAddress string `json:"listed_address"`
+	// SubLists holds the names of the sub-lists the listed address represents,
+	// if a code decoder is configured for the RBL.
+	SubLists []string `json:"sub_lists"`
+	// ScoreValue is the score encoded by the listed address, if a score extractor is
+	// configured for the RBL and the address carries a score.
+	ScoreValue *float64 `json:"score_value"`
+	// Reason is the reason given for the listing, if an answer interpreter is configured for the RBL.
+	Reason string `json:"reason"`
+	// Explanation holds the TXT records of the listing in the RBL's explanation zone, if one is configured (see WithExplanationZone).
+	Explanation []string `json:"explanation"`
 	// RBL lists sometimes add extra information as a TXT record
-	// if any info is present, it will be stored here.
+	// if any info is present, it will be stored here (see NormalizeTXT).
 	Text string `json:"text"`
+	// TextSegments holds the TXT records as returned, without the normalization applied to Text (see NormalizeTXT).
+	TextSegments []string `json:"text_segments"`
+	// TxtQueried indicates whether a TXT lookup was issued for this result, distinguishing
+	// an empty Text due to a missing TXT record from a skipped lookup.
+	TxtQueried bool `json:"txt_queried"`
+	// TxtTimeout indicates the TXT lookup timed out; the listing is still recorded, without Text.
+	TxtTimeout bool `json:"txt_timeout"`
+	// ParsedText holds the fields extracted from Text, if a TXT parser is configured for the RBL.
+	ParsedText map[string]string `json:"parsed_text"`
+	// FirstSeen is the time the listing was first seen, if a first-seen extractor is
+	// configured for the RBL and the TXT record carries one.
+	FirstSeen *time.Time `json:"first_seen"`
+	// RemovalURLTemplate is the RBL's delisting URL pattern, set on listings if one is configured (see RemovalURL)
+	RemovalURLTemplate string `json:"removal_url_template"`
 	// Error represents any error that was encountered (DNS timeout, host not
 	// found, etc.) if any
 	Error bool `json:"error"`
 	// ErrorType is the type of error encountered if any
 	ErrorType error `json:"error_type"`
+	// FetchedAt is the time the RBL answered the query, allowing callers to reason about staleness.
+	FetchedAt time.Time `json:"fetched_at"`
+	// AnsweredBy is the nameserver that answered the query. It is only populated when
+	// the RBL's resolver exposes exchange details (i.e. a Client); it is empty for net.Resolver.
+	AnsweredBy string `json:"answered_by"`
+	// Skipped indicates the IP wasn't looked up as it is private or reserved (see WithSkipUnqueryable)
+	Skipped bool `json:"skipped"`
+	// Overridden indicates the result was answered from a local override (see WithOverrides) rather than the RBL.
+	Overridden bool `json:"overridden"`
+	// FromCache indicates the result was served from the RBL's cache (see WithCache) rather than freshly queried
+	FromCache bool `json:"from_cache"`
+	// Diagnostics holds the wire details of the A exchange, if enabled using WithDiagnostics (requires an Exchanger, i.e. a Client)
+	Diagnostics *Diagnostics `json:"diagnostics"`
+	// Meta holds details of the DNS response, if enabled using WithResponseMeta (requires an Exchanger, i.e. a Client)
+	Meta *ResponseMeta `json:"meta"`
+}
+
+/*
+Failed returns true if the query for this result failed (timeouts, server failures, query
+errors, etc.), as opposed to the RBL answering that the IP isn't listed (NXDOMAIN).
+*/
+func (r Result) Failed() bool {
+	return r.Error && !isNotFound(r.ErrorType)
+}
+
+// RemovalURLPlaceholder is replaced with the listed address by Result.RemovalURL.
+const RemovalURLPlaceholder = "{ip}"
+
+/*
+RemovalURL returns the page where delisting of the result's address can be requested, filling
+RemovalURLPlaceholder in the RBL's template (see WithRemovalURLTemplate) with the escaped address.
+An empty string is returned if the address isn't listed or no template is configured.
+*/
+func (r Result) RemovalURL() string {
+	if !r.Listed || len(r.RemovalURLTemplate) == 0 {
+		return ""
+	}
+
+	return strings.ReplaceAll(r.RemovalURLTemplate, RemovalURLPlaceholder, url.QueryEscape(r.Address))
 }
 
-// NewRBL creates a new RBL struct with the specified hostname and TXT lookup behaviour.
-func NewRBL(hostname string, lookupTxt bool) *RBL {
-	return &RBL{
+/*
+NewRBL creates a new RBL struct with the specified hostname and TXT lookup behaviour, applying
+DefaultOptions followed by any supplied options (so the supplied options take precedence).
+*/
+func NewRBL(hostname string, lookupTxt bool, opts ...Option) *RBL {
+	r := &RBL{
 		hostname:  hostname,
 		lookupTxt: lookupTxt,
 		resolver:  &net.Resolver{},
 	}
+
+	for _, opt := range DefaultOptions {
+		opt(r)
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.maxConcurrency > 0 {
+		r.listLimiter = NewLimiter(r.maxConcurrency)
+	}
+
+	positive, negative := r.cacheTTLs()
+	if positive > 0 || negative > 0 {
+		r.cache = newResultCache(positive, negative, r.cacheMaxEntries, r.staleWindow)
+	}
+
+	return r
 }
 
 /*
 Reverse the octets of a given IPv4 address
 64.233.171.108 becomes 108.171.233.64
+
+Any IPv4 representation is accepted (4-byte, 16-byte and IPv4-mapped IPv6 addresses);
+an empty string is returned for anything else.
 */
 func Reverse(ip net.IP) string {
-	if ip.To4() != nil {
-		splitAddress := strings.Split(ip.String(), ".")
+	if ip4 := ip.To4(); ip4 != nil {
+		return ReverseBytes4([4]byte(ip4))
+	}
+	return ""
+}
+
+/*
+LookupIP looks up the specified IP in the RBL and returns its response. IPs with a local
+override (see WithOverrides) are answered without querying the RBL, as are private and
+reserved IPs if skipped (see WithSkipUnqueryable).
+*/
+func (r *RBL) LookupIP(ctx context.Context, ip net.IP) RBLResults {
+	ret := r.newResults(ip.String())
+
+	if res, ok := r.override(ip); ok {
+		ret.Results = append(ret.Results, res)
+		return ret
+	}
+
+	if r.skipUnqueryable && !IsQueryable(ip) {
+		ret.Results = append(ret.Results, Result{
+			Address: ip.String(),
+			Zone:    r.hostname,
+			Skipped: true,
+		})
+		return ret
+	}
+
+	if r.mapTransition {
+		if v4, ok := EmbeddedIPv4(ip); ok {
+			results := r.queryInput(ctx, v4.String())
+			for i := range results {
+				results[i].MappedFrom = ip.String()
+			}
 
-		for i, j := 0, len(splitAddress)-1; i < len(splitAddress)/2; i, j = i+1, j-1 {
-			splitAddress[i], splitAddress[j] = splitAddress[j], splitAddress[i]
+			ret.Results = append(ret.Results, results...)
+			return ret
 		}
+	}
 
-		return strings.Join(splitAddress, ".")
+	ret.Results = append(ret.Results, r.queryInput(ctx, ip.String())...)
+	return ret
+}
+
+/*
+LookupEncoded encodes the supplied input (an IP address or domain) using the RBL's encoder
+(see WithEncoder) and looks up the resulting label in the RBL.
+*/
+func (r *RBL) LookupEncoded(ctx context.Context, input string) RBLResults {
+	ret := r.newResults(input)
+
+	ret.Results = append(ret.Results, r.queryInput(ctx, input)...)
+	return ret
+}
+
+/*
+LookupIPListed looks up the specified IP in the RBL and returns only the results where the
+IP was listed. An empty slice is returned if the IP is clean.
+*/
+func (r *RBL) LookupIPListed(ctx context.Context, ip net.IP) []Result {
+	listed := []Result{}
+
+	for _, res := range r.LookupIP(ctx, ip).Results {
+		if res.Listed {
+			listed = append(listed, res)
+		}
 	}
-	return ""
+
+	return listed
 }
 
-/**
-LookupIP looks up the specified IP in the RBL and returns its response.
- */
-func (r *RBL) LookupIP(ctx context.Context, ip net.IP) RBLResults {
-	ret := RBLResults{
-		Host:    ip.String(),
-		List:    r.hostname,
-		Results: []Result{},
+/*
+LookupIPSingle looks up the specified IP in the RBL and returns its primary result: the first
+listing, or otherwise a not-listed result. If the IP isn't listed and a query failed, the
+failed result is returned along with its error. This suits the common case of lists
+returning a single answer per query; LookupIP exposes every answer.
+*/
+func (r *RBL) LookupIPSingle(ctx context.Context, ip net.IP) (Result, error) {
+	results := r.LookupIP(ctx, ip).Results
+
+	for _, res := range results {
+		if res.Listed && !res.Failed() {
+			return res, nil
+		}
+	}
+
+	for _, res := range results {
+		if res.Failed() {
+			return res, res.ErrorType
+		}
+	}
+
+	return results[0], nil
+}
+
+/*
+LookupLabel looks up the supplied label in the RBL without reversing or otherwise
+encoding it first. The label is prepended to the RBL hostname verbatim, which allows
+callers to query lists using encoding schemes that gorbl doesn't natively support.
+*/
+func (r *RBL) LookupLabel(ctx context.Context, label string) RBLResults {
+	ret := r.newResults(label)
+
+	ret.Results = append(ret.Results, r.query(ctx, label, label)...)
+	return ret
+}
+
+/*
+LookupReversedIP looks up an IPv4 address already stored in reversed form (i.e. 1.2.0.192
+for 192.0.2.1), using its string form as the query label without reversing it again.
+
+Only use this for addresses known to be pre-reversed: passing an ordinary address queries
+the wrong IP without any error. Results report the address in its usual (un-reversed) form,
+as LookupIP does. Anything other than an IPv4 address is reported as an ErrInvalidInput result.
+*/
+func (r *RBL) LookupReversedIP(ctx context.Context, reversed net.IP) RBLResults {
+	v4 := reversed.To4()
+	if v4 == nil {
+		ret := r.newResults(reversed.String())
+		ret.Results = append(ret.Results, Result{
+			Address:   reversed.String(),
+			Error:     true,
+			ErrorType: fmt.Errorf("%w: %q is not an IPv4 address", ErrInvalidInput, reversed),
+		})
+
+		return ret
+	}
+
+	address := net.IPv4(v4[3], v4[2], v4[1], v4[0]).String()
+	ret := r.newResults(address)
+
+	ret.Results = append(ret.Results, r.query(ctx, address, v4.String())...)
+	return ret
+}
+
+// newResults creates an empty RBLResults for the supplied host searched against this RBL.
+func (r *RBL) newResults(host string) RBLResults {
+	return RBLResults{
+		Host:      host,
+		List:      r.hostname,
+		Whitelist: r.whitelist,
+		Category:  r.category,
+		Weight:    r.weight,
+		Results:   []Result{},
+	}
+}
+
+/*
+queryName joins the supplied label and zone into a fully-qualified query name, using the
+configured prefix and separator (see WithLabelJoin). The trailing dot ensures resolvers
+never apply search domains, which would corrupt the DNSBL query.
+*/
+func (r *RBL) queryName(label string, zone string) string {
+	separator := r.labelSeparator
+	if len(separator) == 0 {
+		separator = "."
+	}
+
+	return fmt.Sprintf("%s%s%s%s.", r.labelPrefix, label, separator, strings.TrimSuffix(zone, "."))
+}
+
+// Limits on the length of DNS names, in octets and excluding the trailing dot.
+const (
+	maxNameLength  = 253
+	maxLabelLength = 63
+)
+
+// validateName returns an error wrapping ErrNameTooLong if the supplied query name exceeds the DNS name or label length limits.
+func validateName(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > maxNameLength {
+		return fmt.Errorf("%w: %q is %d octets, exceeding %d", ErrNameTooLong, name, len(name), maxNameLength)
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if len(label) > maxLabelLength {
+			return fmt.Errorf("%w: label %q is %d octets, exceeding %d", ErrNameTooLong, label, len(label), maxLabelLength)
+		}
+	}
+
+	return nil
+}
+
+// queryInput encodes the supplied input into a label and queries it, reporting encoding failures as an error result.
+func (r *RBL) queryInput(ctx context.Context, input string) []Result {
+	label, err := r.encoderOrDefault().Encode(input)
+	if err != nil {
+		return []Result{{
+			Address:   input,
+			Error:     true,
+			ErrorType: err,
+		}}
+	}
+
+	return r.query(ctx, input, label)
+}
+
+// encoderOrDefault returns the configured encoder, or DefaultEncoder if none is set.
+func (r *RBL) encoderOrDefault() Encoder {
+	if r.encoder == nil {
+		return DefaultEncoder
+	}
+
+	return r.encoder
+}
+
+// zones returns the zones to query: each configured sub-zone under the RBL hostname, or the hostname itself.
+func (r *RBL) zones() []string {
+	if len(r.subZones) == 0 {
+		return []string{r.hostname}
+	}
+
+	zones := make([]string, 0, len(r.subZones))
+	for _, sub := range r.subZones {
+		zones = append(zones, fmt.Sprintf("%s.%s", sub, strings.TrimSuffix(r.hostname, ".")))
+	}
+
+	return zones
+}
+
+// query looks up the supplied label in every zone of the RBL, recording address as the searched value.
+func (r *RBL) query(ctx context.Context, address string, label string) []Result {
+	var results []Result
+
+	for _, zone := range r.zones() {
+		name := r.queryName(label, zone)
+
+		// Names exceeding the DNS limits (i.e. IPv6 labels under a long zone) can never be answered.
+		if err := validateName(name); err != nil {
+			results = append(results, Result{
+				Address:     address,
+				Zone:        zone,
+				QueriedName: name,
+				Error:       true,
+				ErrorType:   err,
+				FetchedAt:   time.Now(),
+			})
+			continue
+		}
+
+		results = append(results, r.queryZone(ctx, address, zone, name)...)
+	}
+
+	return r.applyFailureMode(results)
+}
+
+/*
+queryZone performs the A (and optional TXT) lookup of the supplied name in zone, recording
+address as the searched value. Results are answered from and stored in the cache if enabled;
+failed queries are never cached.
+*/
+func (r *RBL) queryZone(ctx context.Context, address string, zone string, name string) []Result {
+	if r.cache == nil {
+		return r.sharedLookupZone(ctx, address, zone, name)
+	}
+
+	if cached, stale, ok := r.cache.get(name); ok {
+		if stale && r.cache.startRefresh(name) {
+			go r.refreshZone(address, zone, name)
+		}
+
+		// The same name may be reached from different inputs (i.e. LookupLabel and LookupIP).
+		for i := range cached {
+			cached[i].Address = address
+		}
+		return cached
+	}
+
+	return r.fillZone(ctx, address, zone, name)
+}
+
+// fillZone queries the supplied name in zone, caching the results unless the query failed.
+func (r *RBL) fillZone(ctx context.Context, address string, zone string, name string) []Result {
+	results := r.sharedLookupZone(ctx, address, zone, name)
+	for _, res := range results {
+		if res.Failed() {
+			return results
+		}
+	}
+
+	r.cache.put(name, results)
+	return results
+}
+
+/*
+refreshZone re-queries a stale cache entry in the background (see WithStaleWhileRevalidate).
+The query is subject to the RBL's timeout and limiters like any other, and is abandoned once
+the stale window has passed (the entry can no longer be served by then), allowing a later
+lookup to refresh it again. A failed refresh leaves the stale entry in place until it leaves
+the stale window.
+*/
+func (r *RBL) refreshZone(address string, zone string, name string) {
+	defer r.cache.endRefresh(name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.staleWindow)
+	defer cancel()
+
+	// The refresh is waited for subject to ctx, even if the resolver doesn't honour it.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.fillZone(ctx, address, zone, name)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+/*
+sharedLookupZone queries the supplied name in zone, sharing a single in-flight query between
+concurrent identical lookups if deduplication is enabled (see WithDeduplication).
+*/
+func (r *RBL) sharedLookupZone(ctx context.Context, address string, zone string, name string) []Result {
+	if r.inFlight == nil {
+		return r.lookupZone(ctx, address, zone, name)
+	}
+
+	// The shared query is detached from the caller starting it, so that caller giving up doesn't fail the others.
+	shared := r.inFlight.DoChan(name, func() (interface{}, error) {
+		sharedCtx, cancel := r.sharedContext(ctx)
+		defer cancel()
+
+		return r.lookupZone(sharedCtx, address, zone, name), nil
+	})
+
+	var answered []Result
+	select {
+	case res := <-shared:
+		answered = res.Val.([]Result)
+	case <-ctx.Done():
+		return []Result{{
+			Address:     address,
+			Zone:        zone,
+			QueriedName: name,
+			Error:       true,
+			ErrorType:   ctx.Err(),
+			FetchedAt:   time.Now(),
+		}}
+	}
+
+	// Every caller owns its results, recording its own searched value.
+	results := append([]Result(nil), answered...)
+	for i := range results {
+		results[i].Address = address
 	}
 
-	ipHostname := fmt.Sprintf("%s.%s", Reverse(ip), r.hostname)
+	return results
+}
+
+// lookupZone queries the supplied name in zone, bypassing the cache.
+func (r *RBL) lookupZone(ctx context.Context, address string, zone string, name string) []Result {
+	var results []Result
 
-	addrs, err := r.resolver.LookupHost(ctx, ipHostname)
+	aCtx, cancel := r.queryContext(ctx, r.aTimeout)
+
+	var ans answer
+	release, err := r.acquire(aCtx)
+	if err == nil {
+		spanCtx, end := r.startQuery(aCtx, address, name, "A")
+		ans, err = r.lookupHostRetrying(spanCtx, name)
+		end(r.anyListing(address, ans.addrs), err)
+		release()
+	}
+	cancel()
+	addrs := ans.addrs
+	fetchedAt := time.Now()
 
 	if len(addrs) < 1 {
 		res := Result{
-			Address: ip.String(),
-			Listed:  false,
+			Address:     address,
+			Zone:        zone,
+			QueriedName: name,
+			Listed:      false,
+			FetchedAt:   fetchedAt,
+			AnsweredBy:  ans.server,
+			Meta:        ans.meta,
+			Diagnostics: ans.diag,
 		}
 
 		if err != nil {
@@ -117,24 +706,102 @@ func (r *RBL) LookupIP(ctx context.Context, ip net.IP) RBLResults {
 			res.ErrorType = err
 		}
 
-		ret.Results = append(ret.Results, res)
-		return ret
+		return append(results, res)
+	}
+
+	// The TXT lookup is only performed once we know the IP is listed, and is shared by every returned address.
+	var (
+		text       string
+		segments   []string
+		txtTimeout bool
+	)
+	txtQueried := r.lookupTxt && r.wantsTxt(address, addrs)
+	if txtQueried {
+		txtCtx, cancel := r.queryContext(ctx, r.txtTimeout)
+
+		release, err := r.acquire(txtCtx)
+		if err == nil {
+			var txt []string
+			spanCtx, end := r.startQuery(txtCtx, address, name, "TXT")
+			txt, err = r.resolver.LookupTXT(spanCtx, name)
+			end(true, err)
+			release()
+
+			// We skip both empty results and errors; a failed TXT lookup never downgrades the listing.
+			if len(txt) > 0 {
+				text = NormalizeTXT(txt)
+				segments = txt
+			}
+		}
+
+		cancel()
+		txtTimeout = isTimeout(err)
+	}
+
+	var explanation []string
+	if len(r.explanationZone) > 0 && r.anyListing(address, addrs) {
+		explanation = r.explain(ctx, address, zone, name)
 	}
 
-	// For every IP address we get back the RBL IP lookup, we perform an optional TXT lookup.
 	for _, addr := range addrs {
+		listed, reason, classErr := r.classify(address, addr)
+		if classErr != nil || !listed {
+			res := Result{
+				Address:     address,
+				Zone:        zone,
+				QueriedName: name,
+				Listed:      false,
+				FetchedAt:   fetchedAt,
+				AnsweredBy:  ans.server,
+				Meta:        ans.meta,
+				Diagnostics: ans.diag,
+			}
+
+			if classErr != nil {
+				res.Error = true
+				res.ErrorType = classErr
+			}
+
+			results = append(results, res)
+			continue
+		}
+
 		res := Result{
-			Address:       ip.String(),
-			Listed:        true,
-			ListedAddress: addr,
+			Address:            address,
+			Zone:               zone,
+			QueriedName:        name,
+			Listed:             true,
+			ListedAddress:      addr,
+			Text:               text,
+			TextSegments:       segments,
+			TxtQueried:         txtQueried,
+			TxtTimeout:         txtTimeout,
+			FetchedAt:          fetchedAt,
+			AnsweredBy:         ans.server,
+			Meta:               ans.meta,
+			Diagnostics:        ans.diag,
+			RemovalURLTemplate: r.removalURLTemplate,
+			Reason:             reason,
+			Explanation:        explanation,
 		}
 
-		if r.lookupTxt {
-			txt, _ := r.resolver.LookupTXT(ctx, ipHostname)
+		if r.codeDecoder != nil {
+			res.SubLists = r.codeDecoder(addr)
+		}
 
-			// We skip both empty results and errors.
-			if len(txt) > 0 {
-				res.Text = txt[0]
+		if r.scoreExtractor != nil {
+			if score, ok := r.scoreExtractor(addr); ok {
+				res.ScoreValue = &score
+			}
+		}
+
+		if len(text) > 0 && r.txtParser != nil {
+			res.ParsedText = r.txtParser(text)
+		}
+
+		if len(text) > 0 && r.firstSeen != nil {
+			if seen, ok := r.firstSeen(text); ok {
+				res.FirstSeen = &seen
 			}
 		}
 
@@ -143,31 +810,275 @@ func (r *RBL) LookupIP(ctx context.Context, ip net.IP) RBLResults {
 			res.ErrorType = err
 		}
 
-		ret.Results = append(ret.Results, res)
+		results = append(results, res)
 	}
 
-	return ret
+	return results
+}
+
+/*
+explain queries the TXT records of the supplied name's counterpart in the RBL's explanation
+zone. Failures are ignored; they never downgrade the listing.
+*/
+func (r *RBL) explain(ctx context.Context, address string, zone string, name string) []string {
+	label := strings.TrimSuffix(name, strings.TrimSuffix(zone, ".")+".")
+	explanationName := label + strings.TrimSuffix(r.explanationZone, ".") + "."
+
+	ctx, cancel := r.queryContext(ctx, r.txtTimeout)
+	defer cancel()
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil
+	}
+	defer release()
+
+	spanCtx, end := r.startQuery(ctx, address, explanationName, "TXT")
+	txt, err := r.resolver.LookupTXT(spanCtx, explanationName)
+	end(true, err)
+
+	return txt
+}
+
+/*
+classify interprets an address returned for the supplied searched value, returning whether
+it is a listing and the reason given by the RBL's answer interpreter, if any. Without an
+interpreter, query error codes and answers outside the listing range are reported as
+errors: the latter usually indicate a resolver hijacking NXDOMAIN responses.
+*/
+func (r *RBL) classify(address string, addr string) (bool, string, error) {
+	if r.interpreter != nil {
+		listed, reason := r.interpreter(net.ParseIP(address), net.ParseIP(addr))
+		return listed, reason, nil
+	}
+
+	if qErr, ok := ParseQueryError(addr); ok {
+		return false, "", qErr
+	}
+
+	if !r.IsListing(net.ParseIP(addr)) {
+		return false, "", fmt.Errorf("%w: %s", ErrUnexpectedAnswer, addr)
+	}
+
+	return true, "", nil
+}
+
+// anyListing returns true if any of the addresses returned for the supplied searched value encodes a listing.
+func (r *RBL) anyListing(address string, addrs []string) bool {
+	for _, addr := range addrs {
+		if listed, _, err := r.classify(address, addr); listed && err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wantsTxt returns true if any of the addresses returned for the supplied searched value is a listing whose explanation is wanted (see WithTxtCodes).
+func (r *RBL) wantsTxt(address string, addrs []string) bool {
+	for _, addr := range addrs {
+		if listed, _, err := r.classify(address, addr); listed && err == nil && (len(r.txtCodes) == 0 || r.txtCodes[addr]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+IsListing returns true if the supplied address, returned by the RBL, encodes a listing: it
+must fall within the RBL's listing range (127.0.0.0/8 unless set using WithListingRange) and
+not be a query error code (127.255.255.0/24). Without a configured range, any IPv6 address is
+a listing if AAAA answers are enabled (see WithAAAA).
+*/
+func (r *RBL) IsListing(addr net.IP) bool {
+	if addr == nil || queryErrorNet.Contains(addr) {
+		return false
+	}
+
+	if len(r.listingNets) == 0 {
+		if addr.To4() == nil {
+			return r.aaaa
+		}
+		return defaultListingNet.Contains(addr)
+	}
+
+	for _, n := range r.listingNets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+queryContext derives the context used for a single query. A positive timeout specific to the
+query type (see WithATimeout and WithTxtTimeout) always applies, with the caller's deadline
+still winning if earlier; otherwise the configured timeout applies if the caller set no deadline.
+*/
+func (r *RBL) queryContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	if _, ok := ctx.Deadline(); ok || r.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+/*
+sharedContext derives the context of a query shared between callers (see WithDeduplication):
+it keeps the values of the supplied caller's context but not its cancellation. The query is
+bounded by the RBL's timeouts, or by the caller's deadline if none are configured.
+*/
+func (r *RBL) sharedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+
+	if deadline, ok := ctx.Deadline(); ok && r.timeout <= 0 && r.aTimeout <= 0 && r.txtTimeout <= 0 {
+		return context.WithDeadline(detached, deadline)
+	}
+
+	return context.WithCancel(detached)
+}
+
+// budgetContext derives the context shared by every query of a single call, applying the configured budget.
+func (r *RBL) budgetContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, r.budget)
+}
+
+// mappable returns true if transition mapping is enabled and the supplied address embeds an IPv4 address.
+func (r *RBL) mappable(ip net.IP) bool {
+	if !r.mapTransition {
+		return false
+	}
+
+	_, ok := EmbeddedIPv4(ip)
+	return ok
 }
 
 /*
 Lookup performs a search for IPs tied to the specified hostname and returns the response.
+An empty hostname is reported as a single Result with ErrorType set to ErrEmptyHost.
+Percent-encoded and internationalized hostnames are resolved using their ASCII (punycode)
+form, recorded on RBLResults.HostASCII. Only the host's IPv4 addresses (and IPv6 addresses
+embedding one, if WithTransitionMapping is set) are searched; use LookupHostWithIPs to
+search its other IPv6 addresses.
 */
 func (r *RBL) Lookup(ctx context.Context, targetHost string) RBLResults {
-	ret := RBLResults{
-		Host:    targetHost,
-		List:    r.hostname,
-		Results: []Result{},
+	if len(strings.TrimSpace(targetHost)) == 0 {
+		ret := r.newResults(targetHost)
+		ret.Results = append(ret.Results, Result{
+			Address:   targetHost,
+			Error:     true,
+			ErrorType: ErrEmptyHost,
+		})
+
+		return ret
 	}
 
-	// Find all IP addresses associated with the supplied hostname.
-	if addrs, err := r.resolver.LookupIPAddr(ctx, targetHost); err == nil {
-		for _, addr := range addrs {
-			// For every valid IPv4 address tied to this hostname, we perform an RBL lookup.
-			if addr.IP.To4() != nil {
-				qResults := r.LookupIP(ctx, addr.IP)
+	asciiHost, err := asciiHostname(targetHost)
+	if err != nil {
+		ret := r.newResults(targetHost)
+		ret.Results = append(ret.Results, Result{
+			Address:   targetHost,
+			Error:     true,
+			ErrorType: err,
+		})
 
-				ret.Results = append(ret.Results, qResults.Results...)
-			}
+		return ret
+	}
+
+	ctx, cancel := r.budgetContext(ctx)
+	defer cancel()
+
+	var ips []net.IP
+
+	// For every IPv4 address (or mappable transition address) tied to this hostname, we perform an RBL lookup.
+	addrs, err := r.resolver.LookupIPAddr(ctx, asciiHost)
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil || r.mappable(addr.IP) {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	ret := r.LookupHostWithIPs(ctx, targetHost, ips)
+	ret.HostASCII = asciiHost
+
+	// The budget may expire while resolving the host, leaving its IPs unsearched.
+	if err != nil && r.budget > 0 && ctx.Err() != nil {
+		ret.Incomplete = true
+	}
+
+	return ret
+}
+
+/*
+asciiHostname returns the ASCII (punycode) form of the supplied hostname, which may be
+percent-encoded or an internationalized domain name, as needed to resolve it.
+*/
+func asciiHostname(host string) (string, error) {
+	if strings.Contains(host, "%") {
+		if unescaped, err := url.PathUnescape(host); err == nil {
+			host = unescaped
+		}
+	}
+
+	host = strings.TrimSpace(host)
+	if isASCII(host) {
+		return host, nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q is not a valid hostname: %v", ErrInvalidInput, host, err)
+	}
+
+	return ascii, nil
+}
+
+// isASCII returns true if the supplied string has no multi-byte characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+LookupHostWithIPs looks up the supplied IPs in the RBL, reporting the results under the
+specified hostname. Unlike Lookup the hostname isn't resolved, allowing callers to perform
+their own resolution while still aggregating the results per host. Every supplied IP is
+looked up, IPv6 addresses included (as nibble names, see IPv6Encoder); an RBL unable to
+encode one (i.e. using IPv4Encoder) reports an ErrInvalidInput result for it.
+*/
+func (r *RBL) LookupHostWithIPs(ctx context.Context, host string, ips []net.IP) RBLResults {
+	ctx, cancel := r.budgetContext(ctx)
+	defer cancel()
+
+	ret := r.newResults(host)
+
+	for _, ip := range ips {
+		if r.budget > 0 && ctx.Err() != nil {
+			ret.Incomplete = true
+			break
+		}
+
+		ret.Results = append(ret.Results, r.LookupIP(ctx, ip).Results...)
+
+		// The budget may also expire during a lookup, leaving its results failed.
+		if r.budget > 0 && ctx.Err() != nil {
+			ret.Incomplete = true
+			break
 		}
 	}
 
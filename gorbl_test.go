@@ -1,8 +1,13 @@
 package gorbl
 
 import (
+	"errors"
 	"net"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -18,6 +23,28 @@ func TestReverseIP(t *testing.T) {
 	}
 }
 
+func TestReverseIPRepresentations(t *testing.T) {
+	t.Parallel()
+	cases := map[string]net.IP{
+		"4-byte":  {192, 168, 1, 2},
+		"16-byte": {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 192, 168, 1, 2},
+		"parsed":  net.ParseIP("192.168.1.2"),
+		"mapped":  net.ParseIP("::ffff:192.168.1.2"),
+	}
+
+	for name, ip := range cases {
+		if r := Reverse(ip); r != "2.1.168.192" {
+			t.Errorf("Expected %s ip to equal 2.1.168.192, actual %s", name, r)
+		}
+	}
+
+	for _, ip := range []net.IP{nil, {1, 2, 3}, net.ParseIP("2001:db8::1")} {
+		if r := Reverse(ip); r != "" {
+			t.Errorf("Expected an empty string for %v, actual %s", ip, r)
+		}
+	}
+}
+
 func TestLookupParams(t *testing.T) {
 	t.Parallel()
 	rblName := "b.barracudacentral.org"
@@ -33,3 +60,487 @@ func TestLookupParams(t *testing.T) {
 		t.Errorf("Expected smtp.gmail.com, actual %s", res.Host)
 	}
 }
+
+func TestLookupLabelParams(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	for label, listed := range map[string]bool{"2.0.0.127": true, "3.0.0.127": false, "example.com": false} {
+		res := rbl.LookupLabel(context.Background(), label)
+
+		if res.List != "dnsbl.example.org" {
+			t.Errorf("Expected dnsbl.example.org, actual %s", res.List)
+		}
+
+		if res.Host != label {
+			t.Errorf("Expected %s, actual %s", label, res.Host)
+		}
+
+		if len(res.Results) != 1 || res.Results[0].Address != label {
+			t.Fatalf("Expected a result for %s, actual %+v", label, res.Results)
+		}
+
+		if name := res.Results[0].QueriedName; name != label+".dnsbl.example.org." {
+			t.Errorf("Expected %s to be queried as %s.dnsbl.example.org., actual %s", label, label, name)
+		}
+
+		if res.IsListed() != listed {
+			t.Errorf("Expected %s listed %t, actual %+v", label, listed, res.Results)
+		}
+
+		if res.Results[0].FetchedAt.IsZero() {
+			t.Errorf("Expected FetchedAt to be set")
+		}
+	}
+}
+
+func TestQueryContextTimeout(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("b.barracudacentral.org", false, WithTimeout(time.Second))
+
+	ctx, cancel := rbl.queryContext(context.Background(), 0)
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatalf("Expected the timeout to set a deadline")
+	}
+
+	if remaining := time.Until(deadline); remaining > time.Second {
+		t.Errorf("Expected deadline within 1s, actual %s", remaining)
+	}
+}
+
+func TestQueryContextHonoursCallerDeadline(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("b.barracudacentral.org", false, WithTimeout(time.Second))
+
+	for _, d := range []time.Duration{time.Millisecond * 100, time.Minute} {
+		expected := time.Now().Add(d)
+		parent, parentCancel := context.WithDeadline(context.Background(), expected)
+
+		ctx, cancel := rbl.queryContext(parent, 0)
+
+		deadline, ok := ctx.Deadline()
+		if !ok || !deadline.Equal(expected) {
+			t.Errorf("Expected caller deadline %s to be kept, actual %s", expected, deadline)
+		}
+
+		cancel()
+		parentCancel()
+	}
+}
+
+func TestLookupHostWithIPsParams(t *testing.T) {
+	t.Parallel()
+	v6 := net.ParseIP("2001:db8::1")
+	mock := &mockResolver{hosts: map[string][]string{
+		"2.0.0.127.dnsbl.example.org.":          {"127.0.0.2"},
+		ReverseIPv6(v6) + ".dnsbl.example.org.": {"127.0.0.4"},
+	}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	ips := []net.IP{net.ParseIP("127.0.0.2"), v6, net.ParseIP("127.0.0.3")}
+	res := rbl.LookupHostWithIPs(context.Background(), "mail.example.com", ips)
+
+	if res.Host != "mail.example.com" {
+		t.Errorf("Expected mail.example.com, actual %s", res.Host)
+	}
+
+	if len(res.Results) != 3 {
+		t.Fatalf("Expected 3 results, actual %+v", res.Results)
+	}
+
+	expected := []struct {
+		address string
+		listed  bool
+	}{
+		{address: "127.0.0.2", listed: true},
+		{address: "2001:db8::1", listed: true},
+		{address: "127.0.0.3", listed: false},
+	}
+	for i, e := range expected {
+		if r := res.Results[i]; r.Address != e.address || r.Listed != e.listed || r.Failed() {
+			t.Errorf("Expected %s listed %t, actual %+v", e.address, e.listed, r)
+		}
+	}
+
+	// Lists unable to encode IPv6 report the address rather than dropping it.
+	v4Only := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithEncoder(IPv4Encoder))
+	res = v4Only.LookupHostWithIPs(context.Background(), "mail.example.com", []net.IP{v6})
+	if len(res.Results) != 1 || !errors.Is(res.Results[0].ErrorType, ErrInvalidInput) {
+		t.Errorf("Expected an ErrInvalidInput result, actual %+v", res.Results)
+	}
+}
+
+func TestLookupIPListed(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	listed := rbl.LookupIPListed(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(listed) != 1 || listed[0].ListedAddress != "127.0.0.2" {
+		t.Errorf("Expected a single listing, actual %+v", listed)
+	}
+
+	clean := rbl.LookupIPListed(context.Background(), net.ParseIP("192.0.2.1"))
+	if clean == nil || len(clean) != 0 {
+		t.Errorf("Expected an empty slice for a clean IP, actual %+v", clean)
+	}
+}
+
+func TestQueryNameIsFullyQualified(t *testing.T) {
+	t.Parallel()
+	for _, zone := range []string{"dnsbl.example.org", "dnsbl.example.org."} {
+		mock := &mockResolver{}
+		rbl := NewRBL(zone, false, WithResolver(mock))
+
+		rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+		rbl.LookupLabel(context.Background(), "label")
+
+		expected := []string{"1.2.0.192.dnsbl.example.org.", "label.dnsbl.example.org."}
+		if !reflect.DeepEqual(mock.hostQueries, expected) {
+			t.Errorf("Expected queries %v, actual %v", expected, mock.hostQueries)
+		}
+	}
+}
+
+func TestLookupHostWithIPsBudget(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{delay: time.Millisecond * 20}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithBudget(time.Millisecond*50))
+
+	var ips []net.IP
+	for i := 1; i <= 10; i++ {
+		ips = append(ips, net.IPv4(192, 0, 2, byte(i)))
+	}
+
+	res := rbl.LookupHostWithIPs(context.Background(), "mail.example.com", ips)
+
+	if !res.Incomplete {
+		t.Errorf("Expected the results to be marked incomplete")
+	}
+
+	if len(res.Results) >= len(ips) {
+		t.Errorf("Expected fewer than %d results, actual %d", len(ips), len(res.Results))
+	}
+}
+
+func TestLookupHostWithIPsBudgetExpiresDuringLookup(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{delay: time.Millisecond * 200}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithBudget(time.Millisecond*20))
+
+	res := rbl.LookupHostWithIPs(context.Background(), "mail.example.com", []net.IP{net.IPv4(192, 0, 2, 1)})
+
+	if !res.Incomplete {
+		t.Errorf("Expected the results to be marked incomplete")
+	}
+
+	if len(res.Results) != 1 || !res.Results[0].Failed() {
+		t.Errorf("Expected the interrupted lookup to fail, actual %+v", res.Results)
+	}
+}
+
+// blockingIPResolver is a mockResolver whose LookupIPAddr blocks until the context is done.
+type blockingIPResolver struct {
+	*mockResolver
+}
+
+func (b blockingIPResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestLookupBudgetExpiresDuringResolution(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(blockingIPResolver{&mockResolver{}}), WithBudget(time.Millisecond*20))
+
+	res := rbl.Lookup(context.Background(), "mail.example.com")
+
+	if !res.Incomplete || len(res.Results) != 0 {
+		t.Errorf("Expected incomplete results without any listing, actual %+v", res)
+	}
+}
+
+func TestLookupHostWithIPsWithinBudget(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(&mockResolver{}), WithBudget(time.Second))
+
+	res := rbl.LookupHostWithIPs(context.Background(), "mail.example.com", []net.IP{net.IPv4(192, 0, 2, 1)})
+
+	if res.Incomplete || len(res.Results) != 1 {
+		t.Errorf("Expected complete results, actual %+v", res)
+	}
+}
+
+func TestLookupIPSubZones(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.sbl.spamhaus.org.": {"127.0.0.2"}},
+	}
+	rbl := NewRBL("spamhaus.org", false, WithResolver(mock), WithSubZones("sbl", "pbl"))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	if len(res.Results) != 2 {
+		t.Fatalf("Expected one result per sub-zone, actual %+v", res.Results)
+	}
+
+	if res.Results[0].Zone != "sbl.spamhaus.org" || !res.Results[0].Listed {
+		t.Errorf("Expected a listing on sbl.spamhaus.org, actual %+v", res.Results[0])
+	}
+
+	if res.Results[1].Zone != "pbl.spamhaus.org" || res.Results[1].Listed {
+		t.Errorf("Expected no listing on pbl.spamhaus.org, actual %+v", res.Results[1])
+	}
+}
+
+func TestLookupEmptyHost(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	for _, host := range []string{"", "  \t "} {
+		res := rbl.Lookup(context.Background(), host)
+
+		if len(res.Results) != 1 || !res.Results[0].Error || res.Results[0].ErrorType != ErrEmptyHost {
+			t.Errorf("Expected an ErrEmptyHost result for %q, actual %+v", host, res.Results)
+		}
+	}
+
+	if len(mock.hostQueries) != 0 {
+		t.Errorf("Expected no queries, actual %v", mock.hostQueries)
+	}
+}
+
+func TestLookupIPConcurrent(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		txts:  map[string][]string{"2.0.0.127.dnsbl.example.org.": {"Listed"}},
+	}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithCodeDecoder(ZenDecoder), WithTimeout(time.Second))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+			if len(res.Results) != 1 || !res.Results[0].Listed || res.Results[0].Text != "Listed" {
+				t.Errorf("Expected a listed result, actual %+v", res.Results)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if c := mock.txtQueryCount(); c != 50 {
+		t.Errorf("Expected 50 TXT queries, actual %d", c)
+	}
+}
+
+func TestResultFailed(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		errs: map[string]error{"1.2.0.192.dnsbl.example.org.": &net.DNSError{Err: "server misbehaving", IsTemporary: true}},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	if res := rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1")); !res.Results[0].Failed() {
+		t.Errorf("Expected a server failure to be reported as failed, actual %+v", res.Results[0])
+	}
+
+	if res := rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.2")); res.Results[0].Failed() {
+		t.Errorf("Expected NXDOMAIN to not be reported as failed, actual %+v", res.Results[0])
+	}
+}
+
+// TestDefaultOptions isn't parallel as it modifies the package-level DefaultOptions.
+func TestDefaultOptions(t *testing.T) {
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+
+	DefaultOptions = []Option{WithResolver(mock), WithTimeout(time.Second)}
+	defer func() { DefaultOptions = nil }()
+
+	rbl := NewRBL("dnsbl.example.org", false)
+	if rbl.resolver != mock || rbl.timeout != time.Second {
+		t.Errorf("Expected the default options to be applied, actual %+v", rbl)
+	}
+
+	if res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")); !res.IsListed() {
+		t.Errorf("Expected a listing via the default resolver, actual %+v", res.Results)
+	}
+
+	if rbl := NewRBL("dnsbl.example.org", false, WithTimeout(time.Minute)); rbl.timeout != time.Minute || rbl.resolver != mock {
+		t.Errorf("Expected the supplied options to override the defaults, actual %+v", rbl)
+	}
+}
+
+func TestIsListing(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("dnsbl.example.org", false)
+
+	cases := map[string]bool{
+		"127.0.0.2":       true,
+		"127.0.1.4":       true,
+		"127.255.255.254": false,
+		"127.255.255.1":   false,
+		"192.0.2.1":       false,
+		"::1":             false,
+	}
+
+	for addr, expected := range cases {
+		if actual := rbl.IsListing(net.ParseIP(addr)); actual != expected {
+			t.Errorf("Expected IsListing(%s) to be %t, actual %t", addr, expected, actual)
+		}
+	}
+
+	custom := NewRBL("dnsbl.example.org", false, WithListingRange(net.IPNet{IP: net.IPv4(127, 0, 2, 0), Mask: net.CIDRMask(24, 32)}))
+	if custom.IsListing(net.ParseIP("127.0.0.2")) || !custom.IsListing(net.ParseIP("127.0.2.9")) {
+		t.Errorf("Expected only the configured range to be treated as listings")
+	}
+
+	if custom.IsListing(net.ParseIP("127.255.255.254")) || NewRBL("x", false, WithListingRange(net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)})).IsListing(net.ParseIP("127.255.255.255")) {
+		t.Errorf("Expected query error codes to never be treated as listings")
+	}
+}
+
+func TestLookupIPExcludesNonListingAnswers(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{
+			"2.0.0.127.dnsbl.example.org.": {"192.0.2.53"},
+			"3.0.0.127.dnsbl.example.org.": {"127.255.255.254", "127.0.0.3"},
+		},
+	}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.IsListed() || !errors.Is(res.Results[0].ErrorType, ErrUnexpectedAnswer) || res.Results[0].TxtQueried {
+		t.Errorf("Expected an unexpected answer error without a TXT query, actual %+v", res.Results)
+	}
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.3"))
+	if len(res.Results) != 2 || res.Results[0].Listed || !res.Results[1].Listed {
+		t.Errorf("Expected only the non-error code to be a listing, actual %+v", res.Results)
+	}
+}
+
+func TestRemovalURL(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithRemovalURLTemplate("https://www.example.org/lookup?ip={ip}"))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if u := res.Results[0].RemovalURL(); u != "https://www.example.org/lookup?ip=127.0.0.2" {
+		t.Errorf("Expected the filled in removal URL, actual %s", u)
+	}
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if u := res.Results[0].RemovalURL(); u != "" {
+		t.Errorf("Expected no removal URL for an unlisted IP, actual %s", u)
+	}
+
+	v6 := Result{Address: "2001:db8::1", Listed: true, RemovalURLTemplate: "https://www.example.org/lookup?ip={ip}"}
+	if u := v6.RemovalURL(); u != "https://www.example.org/lookup?ip=2001%3Adb8%3A%3A1" {
+		t.Errorf("Expected the address to be escaped, actual %s", u)
+	}
+}
+
+func TestLookupReversedIP(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"1.2.0.192.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	res := rbl.LookupReversedIP(context.Background(), net.ParseIP("1.2.0.192"))
+	if res.Host != "192.0.2.1" || len(res.Results) != 1 || !res.Results[0].Listed || res.Results[0].Address != "192.0.2.1" {
+		t.Errorf("Expected the pre-reversed address to be queried as-is, actual %+v", res)
+	}
+
+	if !reflect.DeepEqual(mock.hostQueries, []string{"1.2.0.192.dnsbl.example.org."}) {
+		t.Errorf("Expected a single query without double reversal, actual %v", mock.hostQueries)
+	}
+
+	res = rbl.LookupReversedIP(context.Background(), net.ParseIP("2001:db8::1"))
+	if len(res.Results) != 1 || !errors.Is(res.Results[0].ErrorType, ErrInvalidInput) {
+		t.Errorf("Expected IPv6 to be rejected, actual %+v", res.Results)
+	}
+}
+
+func TestLookupIDNHost(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		ips:   map[string][]net.IPAddr{"xn--bcher-kva.example": {{IP: net.IPv4(127, 0, 0, 2)}}},
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	for _, host := range []string{"bücher.example", "b%C3%BCcher.example", "BÜCHER.example"} {
+		res := rbl.Lookup(context.Background(), host)
+		if res.Host != host || res.HostASCII != "xn--bcher-kva.example" || !res.IsListed() {
+			t.Errorf("Expected %s to be resolved as xn--bcher-kva.example, actual %+v", host, res)
+		}
+	}
+
+	if res := rbl.Lookup(context.Background(), "mail.example.org"); res.HostASCII != "mail.example.org" {
+		t.Errorf("Expected ASCII hosts to be resolved as-is, actual %+v", res)
+	}
+}
+
+func TestLookupIPSingle(t *testing.T) {
+	t.Parallel()
+	timeout := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.255.255.254", "127.0.0.2", "127.0.0.4"}},
+		errs:  map[string]error{"1.2.0.192.dnsbl.example.org.": timeout},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	res, err := rbl.LookupIPSingle(context.Background(), net.ParseIP("127.0.0.2"))
+	if err != nil || !res.Listed || res.ListedAddress != "127.0.0.2" {
+		t.Errorf("Expected the first listing, actual %+v (%v)", res, err)
+	}
+
+	res, err = rbl.LookupIPSingle(context.Background(), net.ParseIP("192.0.2.2"))
+	if err != nil || res.Listed || res.Address != "192.0.2.2" {
+		t.Errorf("Expected a not-listed result, actual %+v (%v)", res, err)
+	}
+
+	res, err = rbl.LookupIPSingle(context.Background(), net.ParseIP("192.0.2.1"))
+	if err != timeout || !res.Failed() {
+		t.Errorf("Expected the query failure, actual %+v (%v)", res, err)
+	}
+}
+
+func TestLookupIPNameTooLong(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{}
+
+	// An IPv6 address expands to 32 labels (64 octets), leaving less room for the zone.
+	long := strings.Repeat("abcdefghij.", 17) + "example.org"
+	res := NewRBL(long, false, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("2001:db8::1"))
+	if r := res.Results[0]; !errors.Is(r.ErrorType, ErrNameTooLong) || !r.Failed() || len(r.QueriedName) == 0 {
+		t.Errorf("Expected ErrNameTooLong, actual %+v", r)
+	}
+
+	res = NewRBL(strings.Repeat("a", 64)+".example.org", false, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if r := res.Results[0]; !errors.Is(r.ErrorType, ErrNameTooLong) {
+		t.Errorf("Expected ErrNameTooLong for an over-long label, actual %+v", r)
+	}
+
+	if c := mock.hostQueryCount(); c != 0 {
+		t.Errorf("Expected no queries for invalid names, actual %d", c)
+	}
+
+	// Names up to the limits are queried.
+	NewRBL(strings.Repeat("a", 63)+".example.org", false, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if c := mock.hostQueryCount(); c != 1 {
+		t.Errorf("Expected a query for a valid name, actual %d", c)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build go1.23
+
+package gorbl
+
+import "iter"
+
+// All returns an iterator over the results, in the order they are held in Results.
+func (r RBLResults) All() iter.Seq[Result] {
+	return func(yield func(Result) bool) {
+		for _, res := range r.Results {
+			if !yield(res) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+//go:build go1.23
+
+package gorbl
+
+import "testing"
+
+func TestRBLResultsAll(t *testing.T) {
+	t.Parallel()
+	results := RBLResults{
+		Results: []Result{{Address: "192.0.2.1"}, {Address: "192.0.2.2", Listed: true}, {Address: "192.0.2.3"}},
+	}
+
+	var addresses []string
+	for res := range results.All() {
+		addresses = append(addresses, res.Address)
+	}
+
+	if len(addresses) != 3 || addresses[0] != "192.0.2.1" || addresses[2] != "192.0.2.3" {
+		t.Errorf("Expected every result in order, actual %v", addresses)
+	}
+
+	// Breaking out of the loop stops the iteration.
+	var visited int
+	for res := range results.All() {
+		visited++
+		if res.Listed {
+			break
+		}
+	}
+
+	if visited != 2 {
+		t.Errorf("Expected iteration to stop at the listed result, actual %d visited", visited)
+	}
+}
@@ -0,0 +1,137 @@
+package gorbl
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// errorKinds are the package's sentinel errors, recorded by kind when marshalling results so they can be restored.
+var errorKinds = []struct {
+	kind string
+	err  error
+}{
+	{kind: "empty_host", err: ErrEmptyHost},
+	{kind: "invalid_input", err: ErrInvalidInput},
+	{kind: "unexpected_answer", err: ErrUnexpectedAnswer},
+	{kind: "name_too_long", err: ErrNameTooLong},
+	{kind: "cname_loop", err: ErrCNAMELoop},
+	{kind: "cname_depth", err: ErrCNAMEDepth},
+}
+
+// queryErrorKind is the kind recorded for a *QueryError, along with its code.
+const queryErrorKind = "query_error"
+
+/*
+decodedError is the error restored when unmarshalling a Result. The message, whether the
+error indicated NXDOMAIN and the sentinel error it wrapped (if any) survive the round trip.
+*/
+type decodedError struct {
+	message  string
+	notFound bool
+	wrapped  error
+}
+
+// Error returns the original error message.
+func (e *decodedError) Error() string {
+	return e.message
+}
+
+// Unwrap returns the sentinel error the original error wrapped, if any.
+func (e *decodedError) Unwrap() error {
+	return e.wrapped
+}
+
+// resultJSON is the JSON representation of a Result, with the error represented as a string.
+type resultJSON struct {
+	resultFields
+	// ErrorType shadows Result.ErrorType, holding the error message
+	ErrorType *string `json:"error_type"`
+	// ErrorNotFound indicates the error was an NXDOMAIN answer (the IP isn't listed)
+	ErrorNotFound bool `json:"error_not_found"`
+	// ErrorKind identifies the package error the error was or wrapped, if any (see errorKind)
+	ErrorKind string `json:"error_kind,omitempty"`
+	// ErrorCode holds the code of a query error
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// resultFields has the fields of Result without its methods, avoiding recursive (un)marshalling.
+type resultFields Result
+
+/*
+MarshalJSON encodes the result, representing ErrorType as its message so results can be
+unmarshalled again (see UnmarshalJSON).
+*/
+func (r Result) MarshalJSON() ([]byte, error) {
+	aux := resultJSON{resultFields: resultFields(r)}
+
+	if r.ErrorType != nil {
+		msg := r.ErrorType.Error()
+		aux.ErrorType = &msg
+		aux.ErrorNotFound = isNotFound(r.ErrorType)
+		aux.ErrorKind, aux.ErrorCode = errorKind(r.ErrorType)
+	}
+
+	return json.Marshal(aux)
+}
+
+/*
+UnmarshalJSON decodes a result encoded by MarshalJSON. The package's errors are restored so
+errors.Is (for sentinels such as ErrInvalidInput, wrapped or not) and errors.As (for a
+*QueryError) report them as before; other errors are restored with their message, and
+Failed continues to distinguish NXDOMAIN answers from failures.
+*/
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var aux resultJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	*r = Result(aux.resultFields)
+	r.ErrorType = nil
+
+	if aux.ErrorType != nil {
+		r.ErrorType = restoreError(*aux.ErrorType, aux.ErrorNotFound, aux.ErrorKind, aux.ErrorCode)
+	}
+
+	return nil
+}
+
+// errorKind returns the kind of package error the supplied error is or wraps, and its code if it is a query error.
+func errorKind(err error) (string, string) {
+	var qErr *QueryError
+	if errors.As(err, &qErr) {
+		return queryErrorKind, qErr.Code
+	}
+
+	for _, known := range errorKinds {
+		if errors.Is(err, known.err) {
+			return known.kind, ""
+		}
+	}
+
+	return "", ""
+}
+
+/*
+restoreError returns the error decoded from the supplied message and kind: the sentinel
+error itself if the message is unchanged, a decodedError wrapping it otherwise, or the
+*QueryError for the code. Results encoded without a kind fall back to matching the message.
+*/
+func restoreError(message string, notFound bool, kind string, code string) error {
+	if kind == queryErrorKind {
+		if qErr, ok := ParseQueryError(code); ok {
+			return qErr
+		}
+	}
+
+	for _, known := range errorKinds {
+		switch {
+		case known.err.Error() == message:
+			return known.err
+		case known.kind == kind:
+			return &decodedError{message: message, notFound: notFound, wrapped: known.err}
+		}
+	}
+
+	return &decodedError{message: message, notFound: notFound}
+}
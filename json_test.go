@@ -0,0 +1,132 @@
+package gorbl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRBLResultsJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+	score := 5.0
+	original := RBLResults{
+		List: "dnsbl.example.org",
+		Host: "mail.example.com",
+		Results: []Result{
+			{
+				Address:       "192.0.2.1",
+				Zone:          "dnsbl.example.org",
+				Listed:        true,
+				ListedAddress: "127.0.0.2",
+				SubLists:      []string{"SBL"},
+				ScoreValue:    &score,
+				Text:          "trust=2",
+				ParsedText:    map[string]string{"trust": "2"},
+				TxtQueried:    true,
+				FetchedAt:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+			{
+				Address:   "192.0.2.2",
+				Error:     true,
+				ErrorType: &net.DNSError{Err: "no such host", Name: "2.2.0.192.dnsbl.example.org.", IsNotFound: true},
+			},
+			{
+				Address:   "192.0.2.3",
+				Error:     true,
+				ErrorType: &net.DNSError{Err: "server misbehaving", Name: "3.2.0.192.dnsbl.example.org."},
+			},
+			{
+				Error:     true,
+				ErrorType: ErrEmptyHost,
+			},
+		},
+	}
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("Unable to marshal results: %v", err)
+	}
+
+	var decoded RBLResults
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unable to unmarshal results: %v", err)
+	}
+
+	if len(decoded.Results) != len(original.Results) {
+		t.Fatalf("Expected %d results, actual %d", len(original.Results), len(decoded.Results))
+	}
+
+	for i, res := range decoded.Results {
+		orig := original.Results[i]
+
+		if (res.ErrorType == nil) != (orig.ErrorType == nil) || (res.ErrorType != nil && res.ErrorType.Error() != orig.ErrorType.Error()) {
+			t.Errorf("Expected error %v, actual %v", orig.ErrorType, res.ErrorType)
+		}
+
+		if res.Failed() != orig.Failed() {
+			t.Errorf("Expected Failed() to be %t for %v", orig.Failed(), orig.ErrorType)
+		}
+
+		res.ErrorType, orig.ErrorType = nil, nil
+		if !reflect.DeepEqual(res, orig) {
+			t.Errorf("Expected %+v, actual %+v", orig, res)
+		}
+	}
+
+	if decoded.Results[3].ErrorType != ErrEmptyHost {
+		t.Errorf("Expected ErrEmptyHost to be restored, actual %v", decoded.Results[3].ErrorType)
+	}
+}
+
+func TestResultJSONErrorKinds(t *testing.T) {
+	t.Parallel()
+	_, _, invalid := ParseReturnCode("not-a-code")
+	sentinels := []error{
+		ErrEmptyHost,
+		invalid,
+		fmt.Errorf("%w: 192.0.2.1", ErrUnexpectedAnswer),
+		validateName(strings.Repeat("a", 64) + ".example.org"),
+		fmt.Errorf("%w: a.example.org points back to b.example.org", ErrCNAMELoop),
+		fmt.Errorf("%w: more than 8 records", ErrCNAMEDepth),
+	}
+
+	for _, original := range sentinels {
+		decoded := roundTripError(t, original)
+
+		for _, known := range errorKinds {
+			if errors.Is(original, known.err) != errors.Is(decoded, known.err) {
+				t.Errorf("Expected errors.Is(%v, %v) to survive, actual %v", original, known.err, decoded)
+			}
+		}
+
+		if decoded.Error() != original.Error() {
+			t.Errorf("Expected message %q, actual %q", original.Error(), decoded.Error())
+		}
+	}
+
+	qErr, _ := ParseQueryError("127.255.255.254")
+	var decoded *QueryError
+	if err := roundTripError(t, qErr); !errors.As(err, &decoded) || *decoded != *qErr {
+		t.Errorf("Expected the query error to be restored, actual %v", err)
+	}
+}
+
+// roundTripError marshals and unmarshals a failed Result holding the supplied error, returning the restored error.
+func roundTripError(t *testing.T, err error) error {
+	data, marshalErr := json.Marshal(Result{Address: "192.0.2.1", Error: true, ErrorType: err})
+	if marshalErr != nil {
+		t.Fatalf("Unable to marshal result: %v", marshalErr)
+	}
+
+	var res Result
+	if unmarshalErr := json.Unmarshal(data, &res); unmarshalErr != nil {
+		t.Fatalf("Unable to unmarshal result: %v", unmarshalErr)
+	}
+
+	return res.ErrorType
+}
@@ -0,0 +1,126 @@
+package gorbl
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// These tests aren't parallel: verifyNoLeak counts every goroutine in the process, so each runs
+// its scenario in a subtest (letting cleanups finish) before checking nothing was left behind.
+
+/*
+verifyNoLeak returns a function failing the test if more goroutines are running than when
+verifyNoLeak was called, allowing a short grace period for goroutines still winding down.
+*/
+func verifyNoLeak(t *testing.T) func() {
+	before := runtime.NumGoroutine()
+
+	return func() {
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		if after := runtime.NumGoroutine(); after > before {
+			buf := make([]byte, 1<<16)
+			t.Errorf("Expected at most %d goroutines, actual %d:\n%s", before, after, buf[:runtime.Stack(buf, true)])
+		}
+	}
+}
+
+// cancelAfter returns a context cancelled after the supplied delay.
+func cancelAfter(t *testing.T, delay time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	time.AfterFunc(delay, cancel)
+	return ctx
+}
+
+func TestCancelLookupIPNoLeak(t *testing.T) {
+	defer verifyNoLeak(t)()
+
+	t.Run("lookup", func(t *testing.T) {
+		rbl := NewRBL("dnsbl.example.org", true, WithResolver(&mockResolver{delay: time.Second * 5}))
+
+		start := time.Now()
+		res := rbl.LookupIP(cancelAfter(t, time.Millisecond*20), net.ParseIP("192.0.2.1"))
+
+		if time.Since(start) > time.Second || !res.Results[0].Failed() {
+			t.Errorf("Expected the lookup to be cancelled promptly, actual %+v after %s", res.Results, time.Since(start))
+		}
+	})
+}
+
+func TestCancelMultiRBLNoLeak(t *testing.T) {
+	defer verifyNoLeak(t)()
+
+	t.Run("lookup", func(t *testing.T) {
+		slow := &mockResolver{delay: time.Second * 5}
+		lists := []Lookuper{
+			NewRBL("a.example.org", false, WithResolver(slow)),
+			NewRBL("b.example.org", false, WithResolver(slow)),
+			NewRBL("c.example.org", false, WithResolver(slow)),
+		}
+
+		res := NewMultiRBL(lists).LookupIP(cancelAfter(t, time.Millisecond*20), net.ParseIP("192.0.2.1"))
+		if len(res) != 3 {
+			t.Errorf("Expected results for every list, actual %+v", res)
+		}
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		failing := &mockResolver{
+			errs: map[string]error{"1.2.0.192.a.example.org.": &net.DNSError{Err: "server misbehaving"}},
+		}
+		lists := []Lookuper{
+			NewRBL("a.example.org", false, WithResolver(failing)),
+			NewRBL("b.example.org", false, WithResolver(&mockResolver{delay: time.Second * 5})),
+		}
+
+		if _, err := NewMultiRBL(lists, WithFailFast()).LookupIPWithError(context.Background(), net.ParseIP("192.0.2.1")); err == nil {
+			t.Errorf("Expected the failure to be returned")
+		}
+	})
+}
+
+func TestCancelBatchNoLeak(t *testing.T) {
+	defer verifyNoLeak(t)()
+
+	t.Run("batch", func(t *testing.T) {
+		rbl := NewRBL("dnsbl.example.org", false, WithResolver(&mockResolver{}), WithJitter(time.Second*5))
+
+		start := time.Now()
+		rbl.LookupBatch(cancelAfter(t, time.Millisecond*20), []net.IP{net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 2, 2)})
+
+		if time.Since(start) > time.Second {
+			t.Errorf("Expected the jitter wait to be cancelled, took %s", time.Since(start))
+		}
+	})
+}
+
+func TestCancelClientNoLeak(t *testing.T) {
+	defer verifyNoLeak(t)()
+
+	t.Run("client", func(t *testing.T) {
+		// A server which never answers.
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Unable to start silent server: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		rbl := NewRBL("dnsbl.example.org", false, WithResolver(NewClient(conn.LocalAddr().String())))
+
+		start := time.Now()
+		res := rbl.LookupIP(cancelAfter(t, time.Millisecond*20), net.ParseIP("192.0.2.1"))
+
+		if time.Since(start) > time.Second || !res.Results[0].Failed() {
+			t.Errorf("Expected the exchange to be cancelled promptly, actual %+v after %s", res.Results, time.Since(start))
+		}
+	})
+}
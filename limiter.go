@@ -0,0 +1,68 @@
+package gorbl
+
+import "context"
+
+/*
+Limiter bounds the number of DNS queries in flight at once. A single Limiter can be shared
+by many RBLs (see WithLimiter) so that they collectively respect a global concurrency
+bound, protecting a shared resolver.
+*/
+type Limiter struct {
+	// slots holds one entry per query in flight.
+	slots chan struct{}
+}
+
+// NewLimiter creates a new Limiter allowing up to the supplied number of concurrent queries.
+func NewLimiter(concurrency int) *Limiter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Limiter{
+		slots: make(chan struct{}, concurrency),
+	}
+}
+
+// Acquire blocks until a query slot is available, returning the context's error if it is done first.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release returns a query slot obtained by Acquire.
+func (l *Limiter) Release() {
+	<-l.slots
+}
+
+/*
+acquire obtains a query slot from the RBL's own limiter (see WithMaxConcurrency) and then
+its shared limiter (see WithLimiter), if any, returning a function releasing them. The
+RBL's own slot is taken first so a strict list never holds shared capacity while waiting.
+*/
+func (r *RBL) acquire(ctx context.Context) (func(), error) {
+	var held []*Limiter
+
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].Release()
+		}
+	}
+
+	for _, l := range []*Limiter{r.listLimiter, r.limiter} {
+		if l == nil {
+			continue
+		}
+
+		if err := l.Acquire(ctx); err != nil {
+			release()
+			return nil, err
+		}
+		held = append(held, l)
+	}
+
+	return release, nil
+}
@@ -0,0 +1,63 @@
+package gorbl
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestLimiterSharedAcrossRBLs(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{delay: time.Millisecond * 10}
+	limiter := NewLimiter(2)
+
+	rbls := []*RBL{
+		NewRBL("a.example.org", false, WithResolver(mock), WithLimiter(limiter)),
+		NewRBL("b.example.org", false, WithResolver(mock), WithLimiter(limiter)),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(rbl *RBL) {
+			defer wg.Done()
+			rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+		}(rbls[i%2])
+	}
+
+	wg.Wait()
+
+	if mock.maxInFlight > 2 {
+		t.Errorf("Expected at most 2 concurrent queries, actual %d", mock.maxInFlight)
+	}
+
+	if len(mock.hostQueries) != 20 {
+		t.Errorf("Expected 20 queries, actual %d", len(mock.hostQueries))
+	}
+}
+
+func TestLimiterAcquireCancelled(t *testing.T) {
+	t.Parallel()
+	limiter := NewLimiter(1)
+
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatalf("Expected the first acquire to succeed, actual %v", err)
+	}
+	defer limiter.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if err := limiter.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to be exceeded, actual %v", err)
+	}
+
+	rbl := NewRBL("a.example.org", false, WithResolver(&mockResolver{}), WithLimiter(limiter))
+	res := rbl.LookupIP(ctx, net.ParseIP("192.0.2.1"))
+	if !res.Results[0].Failed() {
+		t.Errorf("Expected the lookup to fail while the limiter is full, actual %+v", res.Results[0])
+	}
+}
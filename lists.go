@@ -0,0 +1,19 @@
+package gorbl
+
+/*
+DefaultLists returns a curated set of well-known public DNSBLs, with TXT lookups enabled
+for the lists that publish listing explanations.
+
+List availability and terms of use vary by provider (some restrict free usage to low
+query volumes or non-commercial use, and some refuse queries from public resolvers);
+review each provider's policy before relying on these lists.
+*/
+func DefaultLists() []*RBL {
+	return []*RBL{
+		NewRBL("zen.spamhaus.org", true, WithCodeDecoder(ZenDecoder)),
+		NewRBL("bl.spamcop.net", true),
+		NewRBL("b.barracudacentral.org", false),
+		NewRBL("bl.mailspike.net", true),
+		NewRBL("psbl.surriel.com", false),
+	}
+}
@@ -0,0 +1,29 @@
+package gorbl
+
+import "testing"
+
+func TestDefaultLists(t *testing.T) {
+	t.Parallel()
+	lists := DefaultLists()
+
+	if len(lists) == 0 {
+		t.Fatalf("Expected at least one default list")
+	}
+
+	seen := map[string]bool{}
+	for _, l := range lists {
+		if len(l.hostname) == 0 {
+			t.Errorf("Expected a hostname for every default list")
+		}
+
+		// SORBS was shut down in 2024.
+		if l.hostname == "dnsbl.sorbs.net" {
+			t.Errorf("Expected the retired %s not to be a default list", l.hostname)
+		}
+
+		if seen[l.hostname] {
+			t.Errorf("Expected %s to only be listed once", l.hostname)
+		}
+		seen[l.hostname] = true
+	}
+}
@@ -0,0 +1,56 @@
+package gorbl
+
+import (
+	"net"
+	"strings"
+)
+
+// Bits of each address kept by MaskIP.
+const (
+	maskedIPv4Bits = 24
+	maskedIPv6Bits = 48
+)
+
+/*
+MaskIP is the default IP masker (see WithLogMasking), zeroing the last octet of IPv4
+addresses (192.0.2.1 becomes 192.0.2.0) and all but the first 48 bits of IPv6 addresses
+(2001:db8:1:2::1 becomes 2001:db8:1::). Invalid IPs are returned unchanged.
+*/
+func MaskIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(maskedIPv4Bits, 32))
+	}
+
+	if ip16 := ip.To16(); ip16 != nil {
+		return ip16.Mask(net.CIDRMask(maskedIPv6Bits, 128))
+	}
+
+	return ip
+}
+
+/*
+maskName returns the supplied query name with the label of address replaced by that of the
+masked address, if log masking is enabled and address is an IP.
+*/
+func (r *RBL) maskName(address string, name string) string {
+	if r.logMask == nil {
+		return name
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return name
+	}
+
+	label, err := r.encoderOrDefault().Encode(address)
+	if err != nil {
+		return name
+	}
+
+	masked, err := r.encoderOrDefault().Encode(r.logMask(ip).String())
+	if err != nil {
+		return name
+	}
+
+	return strings.Replace(name, label, masked, 1)
+}
@@ -0,0 +1,46 @@
+package gorbl
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestMaskIP(t *testing.T) {
+	t.Parallel()
+	for input, expected := range map[string]string{
+		"192.0.2.1":         "192.0.2.0",
+		"2001:db8:1:2::1":   "2001:db8:1::",
+		"::ffff:192.0.2.77": "192.0.2.0",
+	} {
+		if masked := MaskIP(net.ParseIP(input)).String(); masked != expected {
+			t.Errorf("Expected %s masked to %s, actual %s", input, expected, masked)
+		}
+	}
+}
+
+func TestWithLogMasking(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"1.2.0.192.dnsbl.example.org.": {"127.0.0.2"}}}
+	tracer := &mockTracer{}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithTracer(tracer), WithLogMasking(nil))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if !res.IsListed() || res.Results[0].QueriedName != "1.2.0.192.dnsbl.example.org." {
+		t.Errorf("Expected the full IP to be queried, actual %+v", res.Results)
+	}
+
+	if len(tracer.spans) != 1 || tracer.spans[0].name != "0.2.0.192.dnsbl.example.org." {
+		t.Errorf("Expected the traced name to be masked, actual %+v", tracer.spans)
+	}
+
+	custom := func(net.IP) net.IP { return net.IPv4zero }
+	tracer = &mockTracer{}
+	rbl = NewRBL("dnsbl.example.org", false, WithResolver(mock), WithTracer(tracer), WithLogMasking(custom))
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+
+	if len(tracer.spans) != 1 || tracer.spans[0].name != "0.0.0.0.dnsbl.example.org." {
+		t.Errorf("Expected the custom mask to be used, actual %+v", tracer.spans)
+	}
+}
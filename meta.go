@@ -0,0 +1,105 @@
+package gorbl
+
+import (
+	"context"
+	"net"
+)
+
+/*
+MetaRBL presents several RBLs as a single logical list, collapsing their answers into one
+verdict per address: an address is listed if any of the lists reports it. Unlike a MultiRBL,
+which reports the results of each list, a MetaRBL returns a single combined Result per
+address, whose ReportedBy holds the lists contributing to the listing.
+
+A MetaRBL is a Lookuper, so it can itself be searched alongside other lists by a MultiRBL.
+*/
+type MetaRBL struct {
+	// name is the logical name of the meta-list, reported as the List of its results.
+	name string
+	// multi queries the underlying lists concurrently.
+	multi *MultiRBL
+}
+
+var _ Lookuper = (*MetaRBL)(nil)
+
+/*
+NewMetaRBL creates a MetaRBL searching the supplied lists under the supplied logical name.
+Any Lookuper can be combined, including other MetaRBLs.
+*/
+func NewMetaRBL(name string, lists ...Lookuper) *MetaRBL {
+	return &MetaRBL{
+		name:  name,
+		multi: NewMultiRBL(lists),
+	}
+}
+
+// LookupIP looks up the specified IP in every list, returning the combined verdict.
+func (m *MetaRBL) LookupIP(ctx context.Context, ip net.IP) RBLResults {
+	return m.combine(ip.String(), m.multi.LookupIP(ctx, ip))
+}
+
+// Lookup looks up the IPs tied to the specified hostname in every list, returning the combined verdict for each IP.
+func (m *MetaRBL) Lookup(ctx context.Context, targetHost string) RBLResults {
+	return m.combine(targetHost, m.multi.Lookup(ctx, targetHost))
+}
+
+/*
+combine collapses the results of each list into a single Result per address, in the order
+the addresses were first reported. The first listing (in list order) provides the details
+of a listed address; an address no list lists reports the first failure, if any.
+*/
+func (m *MetaRBL) combine(host string, rets []RBLResults) RBLResults {
+	ret := RBLResults{
+		Host:    host,
+		List:    m.name,
+		Results: []Result{},
+	}
+
+	var (
+		order    []string
+		combined = map[string]*Result{}
+	)
+
+	for _, rr := range rets {
+		if len(ret.HostASCII) == 0 {
+			ret.HostASCII = rr.HostASCII
+		}
+		ret.Incomplete = ret.Incomplete || rr.Incomplete
+
+		for _, res := range rr.Results {
+			current, ok := combined[res.Address]
+			if !ok {
+				current = &Result{Address: res.Address, Zone: m.name}
+				combined[res.Address] = current
+				order = append(order, res.Address)
+			}
+
+			if res.FetchedAt.After(current.FetchedAt) {
+				current.FetchedAt = res.FetchedAt
+			}
+
+			switch {
+			case res.Listed && !res.Failed():
+				if !current.Listed {
+					reportedBy, fetchedAt := current.ReportedBy, current.FetchedAt
+					*current = res
+					current.Zone = m.name
+					current.ReportedBy, current.FetchedAt = reportedBy, fetchedAt
+				}
+
+				if len(current.ReportedBy) == 0 || current.ReportedBy[len(current.ReportedBy)-1] != rr.List {
+					current.ReportedBy = append(current.ReportedBy, rr.List)
+				}
+			case res.Failed() && !current.Listed && !current.Failed():
+				current.Error = true
+				current.ErrorType = res.ErrorType
+			}
+		}
+	}
+
+	for _, addr := range order {
+		ret.Results = append(ret.Results, *combined[addr])
+	}
+
+	return ret
+}
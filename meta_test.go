@@ -0,0 +1,68 @@
+package gorbl
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestMetaRBL(t *testing.T) {
+	t.Parallel()
+	timeout := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+	mock := &mockResolver{
+		hosts: map[string][]string{
+			"2.0.0.127.a.example.org.": {"127.0.0.2"},
+			"2.0.0.127.c.example.org.": {"127.0.0.4"},
+		},
+		errs: map[string]error{"1.2.0.192.b.example.org.": timeout},
+	}
+	meta := NewMetaRBL("meta.example.org",
+		NewRBL("a.example.org", false, WithResolver(mock)),
+		NewRBL("b.example.org", false, WithResolver(mock)),
+		NewRBL("c.example.org", false, WithResolver(mock)),
+	)
+
+	res := meta.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.List != "meta.example.org" || len(res.Results) != 1 {
+		t.Fatalf("Expected a single combined result, actual %+v", res)
+	}
+
+	if r := res.Results[0]; !r.Listed || r.Error || r.ListedAddress != "127.0.0.2" || r.Zone != "meta.example.org" || !reflect.DeepEqual(r.ReportedBy, []string{"a.example.org", "c.example.org"}) {
+		t.Errorf("Expected a listing reported by a and c, actual %+v", r)
+	}
+
+	// Without any listing, a failure leaves the verdict unknown.
+	if r := meta.LookupIP(context.Background(), net.ParseIP("192.0.2.1")).Results[0]; r.Listed || r.ErrorType != timeout {
+		t.Errorf("Expected the failure to be reported, actual %+v", r)
+	}
+
+	if r := meta.LookupIP(context.Background(), net.ParseIP("192.0.2.2")).Results[0]; r.Listed || r.Failed() || len(r.ReportedBy) > 0 {
+		t.Errorf("Expected a clean verdict, actual %+v", r)
+	}
+
+	// A MetaRBL can be searched alongside other lists.
+	rets := NewMultiRBL([]Lookuper{meta, NewRBL("d.example.org", false, WithResolver(mock))}).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(rets) != 2 || !rets[0].IsListed() || rets[1].IsListed() {
+		t.Errorf("Expected the meta-list to be listed, actual %+v", rets)
+	}
+}
+
+func TestMetaRBLNested(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.a.example.org.": {"127.0.0.2"}}}
+	inner := NewMetaRBL("inner.example.org",
+		NewRBL("a.example.org", false, WithResolver(mock)),
+		&fakeLookuper{list: "fake.example.org", listed: map[string]bool{"192.0.2.1": true}},
+	)
+	outer := NewMetaRBL("outer.example.org", inner, NewRBL("b.example.org", false, WithResolver(mock)))
+
+	// Listings from the RBL and the fake list both surface through the inner meta-list.
+	for _, ip := range []string{"127.0.0.2", "192.0.2.1"} {
+		res := outer.LookupIP(context.Background(), net.ParseIP(ip))
+		if len(res.Results) != 1 || !res.Results[0].Listed || !reflect.DeepEqual(res.Results[0].ReportedBy, []string{"inner.example.org"}) {
+			t.Errorf("Expected %s to be listed by inner.example.org, actual %+v", ip, res)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package gorbl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+/*
+MultiRBL performs lookups against several lists at once, querying each list concurrently.
+Each list is queried using its own configuration (TXT lookups, sub-zones, etc.).
+*/
+type MultiRBL struct {
+	// lists are the lists to search, in the order results are returned.
+	lists []Lookuper
+	// failFast aborts the remaining lookups as soon as one list fails.
+	failFast bool
+	// perListTimeout optionally bounds the time spent on each list.
+	perListTimeout time.Duration
+	// aggregateErrors makes the WithError lookups return every failure as a *MultiError.
+	aggregateErrors bool
+	// collapse merges identical listings reported by several lists or sub-zones.
+	collapse bool
+	// domainLists are the optional domain lists checked by LookupEmail.
+	domainLists *MultiRBL
+	// mxResolver optionally overrides the resolver LookupEmail finds MX hosts with.
+	mxResolver MXResolver
+	// less optionally orders the results, rather than returning them in list order.
+	less func(a, b RBLResults) bool
+}
+
+/*
+MultiOption configures optional behaviour of a MultiRBL. Options are supplied to NewMultiRBL.
+*/
+type MultiOption func(*MultiRBL)
+
+/*
+WithFailFast makes LookupIPWithError and LookupWithError abort as soon as any list query fails
+(timeouts, server failures, etc. but not NXDOMAIN), cancelling the remaining lookups and
+returning the failure. By default failures are only recorded on each Result.
+*/
+func WithFailFast() MultiOption {
+	return func(m *MultiRBL) {
+		m.failFast = true
+	}
+}
+
+/*
+WithPerListTimeout bounds the time spent looking up each list, so a slow list can't hold up
+the aggregate beyond its share. It applies in addition to the deadline of the caller's
+context (the earlier of the two wins). Lists exceeding it report failed results
+(context.DeadlineExceeded), which Evaluate counts as abstentions.
+*/
+func WithPerListTimeout(timeout time.Duration) MultiOption {
+	return func(m *MultiRBL) {
+		m.perListTimeout = timeout
+	}
+}
+
+/*
+WithAggregatedErrors makes LookupIPWithError and LookupWithError return a *MultiError holding
+every failed list query once all lists have answered. WithFailFast takes precedence, returning
+only the first failure. By default failures are only recorded on each Result.
+*/
+func WithAggregatedErrors() MultiOption {
+	return func(m *MultiRBL) {
+		m.aggregateErrors = true
+	}
+}
+
+/*
+WithCollapsedDuplicates merges identical listings (the same address and return code)
+reported by several lists or sub-zones into the first Result reporting it, in list order.
+The merged Result's ReportedBy holds every zone that reported the listing. The duplicates
+are kept on the other lists (so listing counts and Evaluate are unaffected), with
+DuplicateOf naming the zone holding the merged Result, allowing reports to skip them.
+Failed results are never merged.
+*/
+func WithCollapsedDuplicates() MultiOption {
+	return func(m *MultiRBL) {
+		m.collapse = true
+	}
+}
+
+/*
+WithOrdering sorts the results of every lookup using the supplied less function, rather than
+returning them in the order the lists were supplied; lists the function considers equal keep
+their relative order. BySignificance orders the most significant listings first.
+*/
+func WithOrdering(less func(a, b RBLResults) bool) MultiOption {
+	return func(m *MultiRBL) {
+		m.less = less
+	}
+}
+
+/*
+BySignificance is an ordering (see WithOrdering) placing listed results first, then those
+from lists with a higher weight (see WithWeight; lists without a positive weight count with
+a weight of 1), then by category and finally by list name. Lists without a category are
+placed after those with one.
+*/
+func BySignificance(a, b RBLResults) bool {
+	if a.IsListed() != b.IsListed() {
+		return a.IsListed()
+	}
+
+	if wa, wb := listWeight(a), listWeight(b); wa != wb {
+		return wa > wb
+	}
+
+	if a.Category != b.Category {
+		if len(a.Category) == 0 || len(b.Category) == 0 {
+			return len(b.Category) == 0
+		}
+		return a.Category < b.Category
+	}
+
+	return a.List < b.List
+}
+
+// NewMultiRBL creates a new MultiRBL searching the supplied lists, applying any supplied options.
+func NewMultiRBL(lists []Lookuper, opts ...MultiOption) *MultiRBL {
+	m := &MultiRBL{
+		lists: append([]Lookuper(nil), lists...),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+/*
+LookupIP looks up the specified IP in every list, returning one RBLResults per list in
+the order the lists were supplied (unless WithOrdering is set).
+*/
+func (m *MultiRBL) LookupIP(ctx context.Context, ip net.IP) []RBLResults {
+	ret, _ := m.fanOut(ctx, nil, func(ctx context.Context, l Lookuper) RBLResults {
+		return l.LookupIP(ctx, ip)
+	})
+	return ret
+}
+
+/*
+Lookup looks up the IPs tied to the specified hostname in every list, returning one
+RBLResults per list in the order the lists were supplied (unless WithOrdering is set).
+*/
+func (m *MultiRBL) Lookup(ctx context.Context, targetHost string) []RBLResults {
+	ret, _ := m.fanOut(ctx, nil, func(ctx context.Context, l Lookuper) RBLResults {
+		return l.Lookup(ctx, targetHost)
+	})
+	return ret
+}
+
+/*
+LookupIPWithError behaves as LookupIP, but if WithFailFast is set the lookup is aborted on
+the first failed list query, returning the results completed so far (in list order) along
+with the failure. If WithAggregatedErrors is set every failure is returned as a *MultiError.
+*/
+func (m *MultiRBL) LookupIPWithError(ctx context.Context, ip net.IP) ([]RBLResults, error) {
+	return m.withErrors(m.fanOut(ctx, m.failureStop(), func(ctx context.Context, l Lookuper) RBLResults {
+		return l.LookupIP(ctx, ip)
+	}))
+}
+
+/*
+LookupWithError behaves as Lookup, but if WithFailFast is set the lookup is aborted on the
+first failed list query, returning the results completed so far (in list order) along with
+the failure. If WithAggregatedErrors is set every failure is returned as a *MultiError.
+*/
+func (m *MultiRBL) LookupWithError(ctx context.Context, targetHost string) ([]RBLResults, error) {
+	return m.withErrors(m.fanOut(ctx, m.failureStop(), func(ctx context.Context, l Lookuper) RBLResults {
+		return l.Lookup(ctx, targetHost)
+	}))
+}
+
+// withErrors aggregates the failures of the supplied results if WithAggregatedErrors is set (and WithFailFast isn't).
+func (m *MultiRBL) withErrors(results []RBLResults, err error) ([]RBLResults, error) {
+	if m.failFast || !m.aggregateErrors {
+		return results, err
+	}
+
+	return results, aggregateFailures(results)
+}
+
+/*
+LookupStream looks up the specified IP in every list, sending each list's RBLResults on the
+returned channel as soon as it completes, so callers (i.e. a UI) can show progress without
+waiting for the slowest list. Results arrive in completion order, without the MultiRBL's
+post-processing (WithCollapsedDuplicates, WithOrdering). The channel is closed once every
+list has answered, or as soon as the context is done: lists completing afterwards aren't
+sent, even if their lookups ignore the context, so callers may stop reading once they cancel.
+*/
+func (m *MultiRBL) LookupStream(ctx context.Context, ip net.IP) <-chan RBLResults {
+	// Both channels are buffered so lookups never block on a caller that stops reading.
+	out := make(chan RBLResults, len(m.lists))
+	done := make(chan RBLResults, len(m.lists))
+
+	for _, l := range m.lists {
+		go func(l Lookuper) {
+			lctx, lcancel := m.listContext(ctx)
+			defer lcancel()
+
+			done <- l.LookupIP(lctx, ip)
+		}(l)
+	}
+
+	go func() {
+		defer close(out)
+
+		for range m.lists {
+			select {
+			case res := <-done:
+				if ctx.Err() != nil {
+					return
+				}
+
+				select {
+				case out <- res:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+/*
+AllClean looks up the specified IP in every list, returning true only if no list (other than
+whitelists) reports a listing and no query failed. It returns false as soon as any list reports
+a listing, cancelling the remaining lookups; the first failure is returned as an error.
+*/
+func (m *MultiRBL) AllClean(ctx context.Context, ip net.IP) (bool, error) {
+	listed := false
+
+	_, err := m.fanOut(ctx, func(res RBLResults) (bool, error) {
+		if res.IsListed() && !res.Whitelist {
+			listed = true
+			return true, nil
+		}
+
+		err := firstFailure(res)
+		return err != nil, err
+	}, func(ctx context.Context, l Lookuper) RBLResults {
+		return l.LookupIP(ctx, ip)
+	})
+
+	return !listed && err == nil, err
+}
+
+// failureStop returns the stop condition aborting lookups on the first failure if WithFailFast is set.
+func (m *MultiRBL) failureStop() func(RBLResults) (bool, error) {
+	if !m.failFast {
+		return nil
+	}
+
+	return func(res RBLResults) (bool, error) {
+		err := firstFailure(res)
+		return err != nil, err
+	}
+}
+
+// listResults holds the results of a single list, tagged with the list's position.
+type listResults struct {
+	index   int
+	results RBLResults
+}
+
+/*
+fanOut runs the supplied lookup against every list concurrently, collecting the results in
+list order. If stop is set it is called with each list's results as they complete; once it
+returns true the remaining lookups are cancelled and only the results completed so far are
+returned, along with the error stop returned.
+*/
+func (m *MultiRBL) fanOut(ctx context.Context, stop func(RBLResults) (bool, error), lookup func(ctx context.Context, l Lookuper) RBLResults) ([]RBLResults, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The channel is buffered so lookups still running after an early return never block.
+	done := make(chan listResults, len(m.lists))
+	for i, l := range m.lists {
+		go func(i int, l Lookuper) {
+			lctx, lcancel := m.listContext(ctx)
+			defer lcancel()
+
+			done <- listResults{index: i, results: lookup(lctx, l)}
+		}(i, l)
+	}
+
+	collected := make([]*RBLResults, len(m.lists))
+	for range m.lists {
+		lr := <-done
+		collected[lr.index] = &lr.results
+
+		if stop == nil {
+			continue
+		}
+
+		if halt, err := stop(lr.results); halt {
+			cancel()
+			return m.postProcess(compact(collected)), err
+		}
+	}
+
+	return m.postProcess(compact(collected)), nil
+}
+
+// listContext returns the context a single list is looked up with, bounded by any per-list timeout.
+func (m *MultiRBL) listContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.perListTimeout > 0 {
+		return context.WithTimeout(ctx, m.perListTimeout)
+	}
+
+	return ctx, func() {}
+}
+
+// postProcess applies the configured post-processing to the collected results.
+func (m *MultiRBL) postProcess(results []RBLResults) []RBLResults {
+	if m.collapse {
+		results = collapseDuplicates(results)
+	}
+
+	if m.less != nil {
+		sort.SliceStable(results, func(i, j int) bool {
+			return m.less(results[i], results[j])
+		})
+	}
+
+	return results
+}
+
+// collapseDuplicates merges identical listings into the first result reporting them, marking the others as duplicates.
+func collapseDuplicates(results []RBLResults) []RBLResults {
+	type listingKey struct {
+		address       string
+		listedAddress string
+	}
+
+	// first points at the position of the first result for each listing.
+	type position struct {
+		list   int
+		result int
+	}
+	first := map[listingKey]position{}
+
+	ret := make([]RBLResults, len(results))
+	for i, rr := range results {
+		ret[i] = rr
+		ret[i].Results = append([]Result(nil), rr.Results...)
+
+		for j := range ret[i].Results {
+			res := &ret[i].Results[j]
+			if !res.Listed || res.Failed() {
+				continue
+			}
+
+			key := listingKey{address: res.Address, listedAddress: res.ListedAddress}
+			if pos, ok := first[key]; ok {
+				orig := &ret[pos.list].Results[pos.result]
+				orig.ReportedBy = append(orig.ReportedBy, resultZone(rr, *res))
+				res.DuplicateOf = resultZone(ret[pos.list], *orig)
+				continue
+			}
+
+			res.ReportedBy = []string{resultZone(rr, *res)}
+			first[key] = position{list: i, result: j}
+		}
+	}
+
+	return ret
+}
+
+// resultZone returns the zone that reported the supplied result: its sub-zone, if any, otherwise the list.
+func resultZone(rr RBLResults, res Result) string {
+	if len(res.Zone) > 0 {
+		return res.Zone
+	}
+
+	return rr.List
+}
+
+// firstFailure returns the error of the first failed result, if any.
+func firstFailure(results RBLResults) error {
+	for _, res := range results.Results {
+		if res.Failed() {
+			return res.ErrorType
+		}
+	}
+
+	return nil
+}
+
+// aggregateFailures returns a *MultiError holding every failed result, or nil if none failed.
+func aggregateFailures(results []RBLResults) error {
+	var errs []*ListError
+
+	for _, rr := range results {
+		for _, res := range rr.Results {
+			if res.Failed() {
+				errs = append(errs, &ListError{List: rr.List, Address: res.Address, Err: res.ErrorType})
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &MultiError{Errors: errs}
+}
+
+// compact returns the collected results in list order, skipping lists without results.
+func compact(collected []*RBLResults) []RBLResults {
+	ret := make([]RBLResults, 0, len(collected))
+
+	for _, c := range collected {
+		if c != nil {
+			ret = append(ret, *c)
+		}
+	}
+
+	return ret
+}
+
+/*
+EstimateQueries returns the number of DNS queries looking up each of the supplied IPs
+in every list would issue, for lists able to estimate their queries (such as *RBL).
+See RBL.EstimateQueries for how TXT lookups are accounted for.
+*/
+func (m *MultiRBL) EstimateQueries(ips []net.IP) int {
+	total := 0
+
+	for _, l := range m.lists {
+		if e, ok := l.(interface{ EstimateQueries([]net.IP) int }); ok {
+			total += e.EstimateQueries(ips)
+		}
+	}
+
+	return total
+}
+
+/*
+LookupIPByList looks up the specified IP in every list, returning the results keyed by
+list hostname. See ResultsByList for how duplicate list names are handled.
+*/
+func (m *MultiRBL) LookupIPByList(ctx context.Context, ip net.IP) map[string]RBLResults {
+	return ResultsByList(m.LookupIP(ctx, ip))
+}
+
+/*
+ResultsByList indexes the supplied results by list hostname. If a list name occurs more
+than once, the first occurrence is keyed by the name itself and later occurrences by the
+name suffixed with their occurrence number (i.e. "bl.example.org#2"), in slice order.
+*/
+func ResultsByList(results []RBLResults) map[string]RBLResults {
+	ret := make(map[string]RBLResults, len(results))
+	seen := map[string]int{}
+
+	for _, res := range results {
+		seen[res.List]++
+
+		key := res.List
+		if n := seen[res.List]; n > 1 {
+			key = fmt.Sprintf("%s#%d", res.List, n)
+		}
+
+		ret[key] = res
+	}
+
+	return ret
+}
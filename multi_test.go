@@ -0,0 +1,501 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestMultiRBLLookupIP(t *testing.T) {
+	t.Parallel()
+	listed := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.a.example.org.": {"127.0.0.2"}},
+	}
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(listed)),
+		NewRBL("b.example.org", false, WithResolver(&mockResolver{})),
+	})
+
+	res := m.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	if len(res) != 2 || res[0].List != "a.example.org" || res[1].List != "b.example.org" {
+		t.Fatalf("Expected results in list order, actual %+v", res)
+	}
+
+	if !res[0].IsListed() || res[1].IsListed() {
+		t.Errorf("Expected only a.example.org to list the IP, actual %+v", res)
+	}
+}
+
+func TestResultsByList(t *testing.T) {
+	t.Parallel()
+	results := []RBLResults{
+		{List: "a.example.org", Host: "first"},
+		{List: "b.example.org", Host: "second"},
+		{List: "a.example.org", Host: "third"},
+	}
+
+	byList := ResultsByList(results)
+
+	if len(byList) != 3 {
+		t.Fatalf("Expected 3 entries, actual %d", len(byList))
+	}
+
+	if byList["a.example.org"].Host != "first" || byList["a.example.org#2"].Host != "third" || byList["b.example.org"].Host != "second" {
+		t.Errorf("Expected duplicates to be keyed in order, actual %+v", byList)
+	}
+}
+
+func TestMultiRBLLookupIPByList(t *testing.T) {
+	t.Parallel()
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(&mockResolver{})),
+		NewRBL("b.example.org", false, WithResolver(&mockResolver{})),
+	})
+
+	byList := m.LookupIPByList(context.Background(), net.ParseIP("192.0.2.1"))
+
+	for _, list := range []string{"a.example.org", "b.example.org"} {
+		if res, ok := byList[list]; !ok || res.Host != "192.0.2.1" {
+			t.Errorf("Expected results for %s, actual %+v", list, byList)
+		}
+	}
+}
+
+func TestMultiRBLFailFast(t *testing.T) {
+	t.Parallel()
+	failure := &net.DNSError{Err: "server misbehaving", IsTemporary: true}
+	failing := &mockResolver{
+		errs: map[string]error{"1.2.0.192.a.example.org.": failure},
+	}
+	slow := &mockResolver{delay: time.Second * 5}
+
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(failing)),
+		NewRBL("b.example.org", false, WithResolver(slow)),
+	}, WithFailFast())
+
+	start := time.Now()
+	res, err := m.LookupIPWithError(context.Background(), net.ParseIP("192.0.2.1"))
+
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the list failure, actual %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected the slow list to be cancelled, took %s", time.Since(start))
+	}
+
+	if len(res) != 1 || res[0].List != "a.example.org" {
+		t.Errorf("Expected only the failed list's results, actual %+v", res)
+	}
+}
+
+func TestMultiRBLCollectsErrorsByDefault(t *testing.T) {
+	t.Parallel()
+	failing := &mockResolver{
+		errs: map[string]error{"1.2.0.192.a.example.org.": &net.DNSError{Err: "server misbehaving", IsTemporary: true}},
+	}
+
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(failing)),
+		NewRBL("b.example.org", false, WithResolver(&mockResolver{})),
+	})
+
+	res, err := m.LookupIPWithError(context.Background(), net.ParseIP("192.0.2.1"))
+	if err != nil || len(res) != 2 || !res[0].Results[0].Failed() {
+		t.Errorf("Expected both lists' results with the failure recorded, actual %+v (%v)", res, err)
+	}
+}
+
+func TestMultiRBLCollapsedDuplicates(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{
+			"2.0.0.127.a.example.org.":   {"127.0.0.2"},
+			"2.0.0.127.sbl.example.net.": {"127.0.0.2"},
+			"2.0.0.127.pbl.example.net.": {"127.0.0.10"},
+		},
+	}
+
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(mock)),
+		NewRBL("example.net", false, WithResolver(mock), WithSubZones("sbl", "pbl")),
+	}, WithCollapsedDuplicates())
+
+	res := m.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	if len(res) != 2 || len(res[0].Results) != 1 || len(res[1].Results) != 2 {
+		t.Fatalf("Expected every listing to be kept, actual %+v", res)
+	}
+
+	expected := []string{"a.example.org", "sbl.example.net"}
+	if !reflect.DeepEqual(res[0].Results[0].ReportedBy, expected) {
+		t.Errorf("Expected the listing to be reported by %v, actual %v", expected, res[0].Results[0].ReportedBy)
+	}
+
+	if r := res[1].Results[0]; !r.Listed || r.DuplicateOf != "a.example.org" {
+		t.Errorf("Expected the duplicate to stay listed and be marked, actual %+v", r)
+	}
+
+	if r := res[1].Results[1]; r.ListedAddress != "127.0.0.10" || len(r.DuplicateOf) > 0 {
+		t.Errorf("Expected the distinct listing to be kept, actual %+v", r)
+	}
+}
+
+func TestMultiRBLCollapsedDuplicatesEvaluate(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{
+			"1.2.0.192.a.example.org.": {"127.0.0.2"},
+			"1.2.0.192.b.example.org.": {"127.0.0.2"},
+		},
+	}
+	lists := []Lookuper{
+		NewRBL("a.example.org", false, WithResolver(mock)),
+		NewRBL("b.example.org", false, WithResolver(mock)),
+	}
+
+	plain := Evaluate(NewMultiRBL(lists).LookupIP(context.Background(), net.ParseIP("192.0.2.1")), nil)
+	collapsed := Evaluate(NewMultiRBL(lists, WithCollapsedDuplicates()).LookupIP(context.Background(), net.ParseIP("192.0.2.1")), nil)
+
+	if collapsed.ListsHit != 2 || collapsed.Verdict != plain.Verdict {
+		t.Errorf("Expected collapsing to leave the verdict unchanged, expected %s, actual %s", plain, collapsed)
+	}
+}
+
+func TestMultiRBLCollapsedDuplicatesSkipsFailures(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{delay: time.Second * 5}
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(mock), WithFailureMode(FailClosed)),
+		NewRBL("b.example.org", false, WithResolver(mock), WithFailureMode(FailClosed)),
+	}, WithCollapsedDuplicates())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	for _, rr := range m.LookupIP(ctx, net.ParseIP("192.0.2.1")) {
+		if r := rr.Results[0]; !r.Failed() || len(r.ReportedBy) > 0 || len(r.DuplicateOf) > 0 {
+			t.Errorf("Expected the failure on %s to be left alone, actual %+v", rr.List, r)
+		}
+	}
+}
+
+func TestMultiRBLAllClean(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{
+			"2.0.0.127.a.example.org.": {"127.0.0.2"},
+			"3.0.0.127.w.example.org.": {"127.0.0.2"},
+		},
+		errs: map[string]error{"4.0.0.127.a.example.org.": &net.DNSError{Err: "server misbehaving", IsTemporary: true}},
+	}
+	slow := &mockResolver{delay: time.Second * 5}
+
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(mock)),
+		NewRBL("w.example.org", false, WithResolver(mock), AsWhitelist()),
+	})
+
+	if clean, err := m.AllClean(context.Background(), net.ParseIP("127.0.0.3")); !clean || err != nil {
+		t.Errorf("Expected a whitelist hit to be clean, actual %t (%v)", clean, err)
+	}
+
+	if clean, err := m.AllClean(context.Background(), net.ParseIP("127.0.0.4")); clean || err == nil {
+		t.Errorf("Expected a failure to be returned, actual %t (%v)", clean, err)
+	}
+
+	// The listing short-circuits the lookup still waiting on the slow list.
+	m = NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(mock)),
+		NewRBL("b.example.org", false, WithResolver(slow)),
+	})
+
+	start := time.Now()
+	if clean, err := m.AllClean(context.Background(), net.ParseIP("127.0.0.2")); clean || err != nil {
+		t.Errorf("Expected the listing to be reported without error, actual %t (%v)", clean, err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected the listing to short-circuit the lookup, took %s", time.Since(start))
+	}
+}
+
+func TestMultiRBLPerListTXT(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{
+			"2.0.0.127.a.example.org.": {"127.0.0.2"},
+			"2.0.0.127.b.example.org.": {"127.0.0.2"},
+		},
+		txts: map[string][]string{
+			"2.0.0.127.a.example.org.": {"Listed on a"},
+			"2.0.0.127.b.example.org.": {"Listed on b"},
+		},
+	}
+
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", true, WithResolver(mock)),
+		NewRBL("b.example.org", false, WithResolver(mock)),
+	})
+
+	res := m.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(res) != 2 {
+		t.Fatalf("Expected results for both lists, actual %+v", res)
+	}
+
+	if r := res[0].Results[0]; !r.TxtQueried || r.Text != "Listed on a" {
+		t.Errorf("Expected the TXT-enabled list to query TXT, actual %+v", r)
+	}
+
+	if r := res[1].Results[0]; r.TxtQueried || len(r.Text) > 0 {
+		t.Errorf("Expected the TXT-disabled list to skip TXT, actual %+v", r)
+	}
+
+	if c := mock.txtQueryCount(); c != 1 {
+		t.Errorf("Expected a single TXT query, actual %d", c)
+	}
+}
+
+func TestMultiRBLAggregatedErrors(t *testing.T) {
+	t.Parallel()
+	timeout := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+	mock := &mockResolver{
+		errs: map[string]error{
+			"1.2.0.192.a.example.org.": &net.DNSError{Err: "server misbehaving", IsTemporary: true},
+			"1.2.0.192.c.example.org.": timeout,
+		},
+	}
+	lists := []Lookuper{
+		NewRBL("a.example.org", false, WithResolver(mock)),
+		NewRBL("b.example.org", false, WithResolver(mock)),
+		NewRBL("c.example.org", false, WithResolver(mock)),
+	}
+
+	res, err := NewMultiRBL(lists, WithAggregatedErrors()).LookupIPWithError(context.Background(), net.ParseIP("192.0.2.1"))
+	if len(res) != 3 {
+		t.Errorf("Expected every list's results, actual %+v", res)
+	}
+
+	var multi *MultiError
+	if !errors.As(err, &multi) || len(multi.Errors) != 2 {
+		t.Fatalf("Expected a MultiError with 2 failures, actual %v", err)
+	}
+
+	if multi.Errors[0].List != "a.example.org" || multi.Errors[1].List != "c.example.org" {
+		t.Errorf("Expected the failures in list order, actual %v", err)
+	}
+
+	if !errors.Is(err, timeout) {
+		t.Errorf("Expected errors.Is to find the timeout, actual %v", err)
+	}
+
+	var listErr *ListError
+	if !errors.As(err, &listErr) || listErr.List != "a.example.org" {
+		t.Errorf("Expected errors.As to find the first ListError, actual %v", listErr)
+	}
+
+	if _, err := NewMultiRBL(lists[1:2], WithAggregatedErrors()).LookupIPWithError(context.Background(), net.ParseIP("192.0.2.1")); err != nil {
+		t.Errorf("Expected no error without failures, actual %v", err)
+	}
+}
+
+func TestMultiRBLPerListTimeout(t *testing.T) {
+	t.Parallel()
+	listed := &mockResolver{hosts: map[string][]string{"2.0.0.127.a.example.org.": {"127.0.0.2"}}}
+	slow := &mockResolver{delay: time.Second * 5}
+
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(listed)),
+		NewRBL("b.example.org", false, WithResolver(slow)),
+	}, WithPerListTimeout(time.Millisecond*50))
+
+	start := time.Now()
+	res := m.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected the slow list to be abandoned, took %s", time.Since(start))
+	}
+
+	if len(res) != 2 || !res[0].IsListed() {
+		t.Fatalf("Expected the fast list's listing, actual %+v", res)
+	}
+
+	if r := res[1].Results[0]; !r.Failed() || !errors.Is(r.ErrorType, context.DeadlineExceeded) {
+		t.Errorf("Expected the slow list to time out, actual %+v", r)
+	}
+}
+
+func TestMultiRBLOrdering(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{
+		"1.2.0.192.one.example.org.":  {"127.0.0.2"},
+		"1.2.0.192.two.example.org.":  {"127.0.0.2"},
+		"1.2.0.192.four.example.org.": {"127.0.0.2"},
+		"1.2.0.192.five.example.org.": {"127.0.0.2"},
+	}}
+	lists := []Lookuper{
+		NewRBL("one.example.org", false, WithResolver(mock), WithCategory(CategorySpam)),
+		NewRBL("two.example.org", false, WithResolver(mock), WithWeight(3)),
+		NewRBL("three.example.org", false, WithResolver(mock), WithWeight(5)),
+		NewRBL("four.example.org", false, WithResolver(mock), WithWeight(3), WithCategory(CategoryPolicy)),
+		NewRBL("five.example.org", false, WithResolver(mock), WithWeight(3), WithCategory(CategoryPolicy)),
+	}
+
+	results := NewMultiRBL(lists, WithOrdering(BySignificance)).LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+
+	var order []string
+	for _, res := range results {
+		order = append(order, res.List)
+	}
+
+	expected := []string{"five.example.org", "four.example.org", "two.example.org", "one.example.org", "three.example.org"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected %v, actual %v", expected, order)
+	}
+
+	byName := func(a, b RBLResults) bool { return a.List < b.List }
+	results = NewMultiRBL(lists, WithOrdering(byName)).LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+
+	order = order[:0]
+	for _, res := range results {
+		order = append(order, res.List)
+	}
+
+	expected = []string{"five.example.org", "four.example.org", "one.example.org", "three.example.org", "two.example.org"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected %v, actual %v", expected, order)
+	}
+}
+
+func TestMultiRBLLookupStream(t *testing.T) {
+	t.Parallel()
+	fast := &mockResolver{hosts: map[string][]string{"1.2.0.192.fast.example.org.": {"127.0.0.2"}}}
+	slow := &mockResolver{delay: time.Millisecond * 100}
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("slow.example.org", false, WithResolver(slow)),
+		NewRBL("fast.example.org", false, WithResolver(fast)),
+		NewRBL("other.example.org", false, WithResolver(fast)),
+	})
+
+	var order []string
+	for res := range m.LookupStream(context.Background(), net.ParseIP("192.0.2.1")) {
+		order = append(order, res.List)
+	}
+
+	if len(order) != 3 {
+		t.Fatalf("Expected 3 results, actual %v", order)
+	}
+
+	if order[2] != "slow.example.org" {
+		t.Errorf("Expected the slow list to be emitted last, actual %v", order)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := m.LookupStream(ctx, net.ParseIP("192.0.2.1"))
+
+	received := 0
+	for range stream {
+		received++
+		if received == 2 {
+			cancel()
+		}
+	}
+	cancel()
+
+	if received != 2 {
+		t.Errorf("Expected the stream to close once cancelled, actual %d results", received)
+	}
+}
+
+func TestMultiRBLLookupStreamCancelled(t *testing.T) {
+	t.Parallel()
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+
+	m := NewMultiRBL([]Lookuper{
+		&fakeLookuper{list: "fast.example.org"},
+		&fakeLookuper{list: "stuck.example.org", block: block},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := m.LookupStream(ctx, net.ParseIP("192.0.2.1"))
+
+	if res := <-stream; res.List != "fast.example.org" {
+		t.Fatalf("Expected the fast list first, actual %+v", res)
+	}
+	cancel()
+
+	// The stuck lookup ignores the context, yet the stream closes without it.
+	select {
+	case res, ok := <-stream:
+		if ok {
+			t.Errorf("Expected the stream to close once cancelled, actual %+v", res)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the stream to close promptly once cancelled")
+	}
+}
+
+// fakeLookuper is a Lookuper that isn't an *RBL, answering from a static set of listed inputs.
+type fakeLookuper struct {
+	list   string
+	listed map[string]bool
+	// block optionally holds up LookupIP until it is closed, ignoring the context.
+	block chan struct{}
+}
+
+func (f *fakeLookuper) LookupIP(ctx context.Context, ip net.IP) RBLResults {
+	if f.block != nil {
+		<-f.block
+	}
+
+	return f.answer(ip.String())
+}
+
+func (f *fakeLookuper) Lookup(ctx context.Context, targetHost string) RBLResults {
+	return f.answer(targetHost)
+}
+
+func (f *fakeLookuper) LookupEncoded(ctx context.Context, input string) RBLResults {
+	return f.answer(input)
+}
+
+// answer returns the results for the supplied input, listed if it is in the listed set.
+func (f *fakeLookuper) answer(input string) RBLResults {
+	res := RBLResults{List: f.list, Host: input, Results: []Result{{Address: input, Zone: f.list}}}
+	if f.listed[input] {
+		res.Results[0].Listed = true
+		res.Results[0].ListedAddress = "127.0.0.2"
+	}
+
+	return res
+}
+
+func TestMultiRBLFakeLookuper(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"1.2.0.192.dnsbl.example.org.": {"127.0.0.2"}}}
+	m := NewMultiRBL([]Lookuper{
+		&fakeLookuper{list: "fake.example.org", listed: map[string]bool{"192.0.2.2": true, "mail.example.com": true}},
+		NewRBL("dnsbl.example.org", false, WithResolver(mock)),
+	})
+
+	results := m.LookupIP(context.Background(), net.ParseIP("192.0.2.2"))
+	if len(results) != 2 || results[0].List != "fake.example.org" || !results[0].IsListed() || results[1].IsListed() {
+		t.Errorf("Expected only the fake list to report 192.0.2.2, actual %+v", results)
+	}
+
+	results = m.Lookup(context.Background(), "mail.example.com")
+	if len(results) != 2 || !results[0].IsListed() || results[0].Host != "mail.example.com" {
+		t.Errorf("Expected the fake list to report the host, actual %+v", results)
+	}
+
+	if ok, _ := m.AllClean(context.Background(), net.ParseIP("192.0.2.3")); !ok {
+		t.Errorf("Expected 192.0.2.3 to be clean on every list")
+	}
+}
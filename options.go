@@ -0,0 +1,537 @@
+package gorbl
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+/*
+Option configures optional behaviour of an RBL. Options are supplied to NewRBL.
+*/
+type Option func(*RBL)
+
+/*
+DefaultOptions are applied by NewRBL to every RBL before the options supplied to it, letting
+a service share a base configuration (resolver, timeout, limiter, etc.) across all its lists.
+Options supplied to NewRBL override the defaults.
+
+DefaultOptions isn't synchronized; set it during initialization, before any RBLs are created.
+*/
+var DefaultOptions []Option
+
+/*
+WithExplanationZone sets a parallel zone holding the details of the RBL's listings, for
+providers keeping listing presence and listing detail in separate zones. When a listing is
+found, the same label is queried for TXT records in the explanation zone, which are stored
+on Result.Explanation.
+*/
+func WithExplanationZone(zone string) Option {
+	return func(r *RBL) {
+		r.explanationZone = zone
+	}
+}
+
+/*
+WithAnswerInterpreter sets the interpreter deciding whether returned addresses are listings,
+replacing the listing range (see WithListingRange) and query error code checks. Answers it
+rejects are reported as not listed.
+*/
+func WithAnswerInterpreter(interpreter AnswerInterpreter) Option {
+	return func(r *RBL) {
+		r.interpreter = interpreter
+	}
+}
+
+// WithCodeDecoder sets the decoder used to translate listed addresses into sub-list names.
+func WithCodeDecoder(decoder CodeDecoder) Option {
+	return func(r *RBL) {
+		r.codeDecoder = decoder
+	}
+}
+
+/*
+WithTxtCodes restricts TXT lookups (if enabled for the RBL) to listings returning one of the
+supplied addresses (i.e. "127.0.0.2"), reducing the queries issued for codes whose explanation
+isn't needed. The TXT record is recorded on every result of a query returning a matching code.
+*/
+func WithTxtCodes(codes ...string) Option {
+	return func(r *RBL) {
+		r.txtCodes = map[string]bool{}
+		for _, code := range codes {
+			r.txtCodes[code] = true
+		}
+	}
+}
+
+/*
+WithTimeout bounds each query against the RBL to the supplied duration.
+
+The timeout only applies to contexts without a deadline: if the context passed to a
+lookup already carries a deadline, the caller's deadline takes precedence (whether it
+is shorter or longer) and the timeout is not applied. See WithATimeout and WithTxtTimeout
+to bound the A and TXT queries independently.
+*/
+func WithTimeout(timeout time.Duration) Option {
+	return func(r *RBL) {
+		r.timeout = timeout
+	}
+}
+
+/*
+WithATimeout bounds the A queries, which determine whether an IP is listed, to the supplied
+duration, overriding WithTimeout. Unlike WithTimeout it applies even if the caller's context
+carries a deadline; the earlier of the two wins.
+*/
+func WithATimeout(timeout time.Duration) Option {
+	return func(r *RBL) {
+		r.aTimeout = timeout
+	}
+}
+
+/*
+WithTxtTimeout bounds the TXT queries enriching listings (including those against an
+explanation zone) to the supplied duration, overriding WithTimeout, so they can be given
+longer than the A query or cut short. It applies as WithATimeout does. A TXT query timing
+out never downgrades the listing (see Result.TxtTimeout).
+*/
+func WithTxtTimeout(timeout time.Duration) Option {
+	return func(r *RBL) {
+		r.txtTimeout = timeout
+	}
+}
+
+/*
+WithDeduplication shares a single in-flight query between concurrent lookups of the same
+name, reducing the load on the RBL during bursts of identical requests. The shared query
+isn't cancelled with any one caller's context; it is bounded by the RBL's timeouts (see
+WithTimeout), or the deadline of the caller starting it if none are configured. Each caller
+waits for it subject to its own context, receiving a failed result if that is done first.
+*/
+func WithDeduplication() Option {
+	return func(r *RBL) {
+		r.inFlight = &singleflight.Group{}
+	}
+}
+
+/*
+WithCache caches the results of each query for the supplied TTL, answering repeated lookups
+without querying the RBL. Failed queries aren't cached. See WithPositiveTTL and WithNegativeTTL
+to tune the TTL by result, WithMaxCacheEntries to bound the memory used, and RBL.CacheStats
+to monitor the cache.
+*/
+func WithCache(ttl time.Duration) Option {
+	return func(r *RBL) {
+		r.cacheTTL = ttl
+	}
+}
+
+/*
+WithStaleWhileRevalidate serves cached results for up to the supplied window past their TTL,
+refreshing them in the background, so lookups are answered without waiting for the RBL.
+At most one refresh of each query runs at once, subject to the RBL's limiters and abandoned
+if it takes longer than the window. It requires caching to be enabled (see WithCache).
+*/
+func WithStaleWhileRevalidate(window time.Duration) Option {
+	return func(r *RBL) {
+		r.staleWindow = window
+	}
+}
+
+/*
+WithPositiveTTL sets how long query results reporting a listing are cached, overriding the
+WithCache TTL. It enables caching of listings on its own.
+*/
+func WithPositiveTTL(ttl time.Duration) Option {
+	return func(r *RBL) {
+		r.positiveTTL = ttl
+	}
+}
+
+/*
+WithNegativeTTL sets how long query results not reporting a listing (NXDOMAIN) are cached,
+overriding the WithCache TTL. It enables caching of such results on its own.
+*/
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(r *RBL) {
+		r.negativeTTL = ttl
+	}
+}
+
+/*
+WithMaxCacheEntries bounds the number of queries cached (see WithCache), evicting the least
+recently used entry once the limit is reached. The cache is only bounded by its TTL by default.
+*/
+func WithMaxCacheEntries(entries int) Option {
+	return func(r *RBL) {
+		r.cacheMaxEntries = entries
+	}
+}
+
+/*
+WithJitter inserts a random delay of up to the supplied duration between the queries made
+by LookupBatch. This smooths traffic during large scans, reducing the chance of tripping
+provider rate limits. The default of 0 disables jitter.
+*/
+func WithJitter(jitter time.Duration) Option {
+	return func(r *RBL) {
+		r.jitter = jitter
+	}
+}
+
+// WithTxtParser sets the parser used to extract structured fields from TXT records into Result.ParsedText.
+func WithTxtParser(parser TxtParser) Option {
+	return func(r *RBL) {
+		r.txtParser = parser
+	}
+}
+
+/*
+WithFirstSeenExtractor sets the extractor used to read the time listings were first seen
+from their TXT records into Result.FirstSeen. TXT lookups must be enabled for the RBL.
+*/
+func WithFirstSeenExtractor(extractor FirstSeenExtractor) Option {
+	return func(r *RBL) {
+		r.firstSeen = extractor
+	}
+}
+
+/*
+WithSkipUnqueryable makes LookupIP skip private and reserved IPs (see IsQueryable) without
+querying the RBL, reporting a not-listed Result with Skipped set.
+*/
+func WithSkipUnqueryable() Option {
+	return func(r *RBL) {
+		r.skipUnqueryable = true
+	}
+}
+
+/*
+WithOverrides sets locally maintained verdicts, keyed by IP, which LookupIP answers without
+querying the RBL (see ParseOverrides). This allows offline testing, and layering locally
+curated decisions on top of the list. The map is copied.
+*/
+func WithOverrides(overrides map[string]Override) Option {
+	return func(r *RBL) {
+		r.overrides = make(map[string]Override, len(overrides))
+		for addr, override := range overrides {
+			if ip := net.ParseIP(addr); ip != nil {
+				addr = ip.String()
+			}
+			r.overrides[addr] = override
+		}
+	}
+}
+
+// WithTracer sets the tracer invoked around each DNS query the RBL issues (see Tracer).
+func WithTracer(tracer Tracer) Option {
+	return func(r *RBL) {
+		r.tracer = tracer
+	}
+}
+
+/*
+WithLogMasking masks the IP in the query names reported to the tracer (see WithTracer),
+for deployments that must not log full IPs. The full IP is still queried and recorded on
+results. The supplied function masks each IP; MaskIP is used if it is nil. Use
+WriteSyslogMasked to mask the IPs written as syslog lines.
+*/
+func WithLogMasking(mask func(net.IP) net.IP) Option {
+	return func(r *RBL) {
+		if mask == nil {
+			mask = MaskIP
+		}
+		r.logMask = mask
+	}
+}
+
+// WithResolver sets the resolver used to perform the RBL's DNS lookups.
+func WithResolver(resolver Resolver) Option {
+	return func(r *RBL) {
+		r.resolver = resolver
+	}
+}
+
+/*
+WithGoResolver makes the RBL resolve using Go's pure resolver (net.Resolver with PreferGo
+set) and repeats lookups that time out up to retransmits more times, giving the same
+behaviour on every platform.
+
+By default net.Resolver may use the system's (cgo) resolver instead, depending on the
+platform and the GODEBUG netdns setting. For DNSBL queries the two differ: the cgo resolver
+answers A lookups through getaddrinfo, so queries may be answered from a system cache (such
+as nscd or mDNSResponder) holding stale listings, a SERVFAIL may be indistinguishable from
+NXDOMAIN (reporting a failed query as not listed), and lookups aren't always abandoned when
+their context is done. TXT lookups always use the pure resolver. The pure resolver queries
+the nameservers in resolv.conf directly, sending each query "attempts" times (2 by default)
+per server; that count can't be set per resolver, so the retransmits here are in addition
+to it. WithGoResolver replaces any resolver set by an earlier WithResolver or WithDialer
+option (and vice versa).
+*/
+func WithGoResolver(retransmits int) Option {
+	return func(r *RBL) {
+		r.resolver = &retransmitResolver{
+			Resolver:    &net.Resolver{PreferGo: true},
+			retransmits: retransmits,
+		}
+	}
+}
+
+// AsWhitelist marks the RBL as a whitelist; listings on it count in favour of the host or IP.
+func AsWhitelist() Option {
+	return func(r *RBL) {
+		r.whitelist = true
+	}
+}
+
+// WithFailureMode sets how failed queries are reported; FailOpen is used by default.
+func WithFailureMode(mode FailureMode) Option {
+	return func(r *RBL) {
+		r.failureMode = mode
+	}
+}
+
+/*
+WithWeight records the relative trust placed in the RBL on its results (see
+RBLResults.Weight), used when weighing the lists that answered a lookup (see
+Reputation.Confidence). Lists without a positive weight count with a weight of 1.
+*/
+func WithWeight(weight float64) Option {
+	return func(r *RBL) {
+		r.weight = weight
+	}
+}
+
+/*
+WithServFailHandling sets how SERVFAIL answers are handled; ServFailUnknown is used by
+default. Set it in DefaultOptions to change the default for every list, overriding it on
+individual RBLs as required.
+*/
+func WithServFailHandling(handling ServFailHandling) Option {
+	return func(r *RBL) {
+		r.servFail = handling
+	}
+}
+
+// WithCategory records the kind of listing the RBL reports on its results (see CountCategories).
+func WithCategory(category Category) Option {
+	return func(r *RBL) {
+		r.category = category
+	}
+}
+
+/*
+WithBudget caps the total time spent by a single Lookup, LookupHostWithIPs or LookupBatch
+call across all of the queries it makes. Once the budget expires the partial results are
+returned with Incomplete set.
+*/
+func WithBudget(budget time.Duration) Option {
+	return func(r *RBL) {
+		r.budget = budget
+	}
+}
+
+/*
+WithSubZones configures sub-zones beneath the RBL hostname which are each queried in
+place of the hostname itself. For example, an RBL for "spamhaus.org" with the sub-zones
+"sbl" and "pbl" queries both sbl.spamhaus.org and pbl.spamhaus.org, recording the zone that
+produced each Result.
+*/
+func WithSubZones(subZones ...string) Option {
+	return func(r *RBL) {
+		r.subZones = append([]string(nil), subZones...)
+	}
+}
+
+/*
+WithListingRange sets the ranges returned addresses must fall in to be treated as listings,
+replacing the default of 127.0.0.0/8. Query error codes are never treated as listings.
+*/
+func WithListingRange(ranges ...net.IPNet) Option {
+	return func(r *RBL) {
+		r.listingNets = ranges
+	}
+}
+
+/*
+WithAAAA includes AAAA answers from the zone in the results, for the few lists encoding extra
+data in them. Each AAAA answer is reported as a listing (subject to WithListingRange).
+An Exchanger (i.e. a Client) issues a separate AAAA query; other resolvers must return AAAA
+answers from LookupHost, as net.Resolver does. AAAA answers are ignored by default.
+*/
+func WithAAAA() Option {
+	return func(r *RBL) {
+		r.aaaa = true
+	}
+}
+
+/*
+WithRemovalURLTemplate sets the RBL's delisting URL pattern, recorded on every listing so
+Result.RemovalURL can direct users to it (i.e. "https://www.example.org/lookup?ip={ip}").
+*/
+func WithRemovalURLTemplate(template string) Option {
+	return func(r *RBL) {
+		r.removalURLTemplate = template
+	}
+}
+
+/*
+WithResponseMeta records the details of each DNS response (rcode, answer count and whether
+it was authoritative) on Result.Meta. It requires the RBL's resolver to be an Exchanger
+(i.e. a Client); Meta is left nil otherwise.
+*/
+func WithResponseMeta() Option {
+	return func(r *RBL) {
+		r.responseMeta = true
+	}
+}
+
+/*
+WithDiagnostics records the wire details of each A exchange on its results (see
+Result.Diagnostics): the query and response sizes, and whether a truncated UDP response
+forced the query to be repeated over TCP. This is an advanced diagnostic for troubleshooting
+truncation and large answers, requiring the RBL's resolver to be an Exchanger (i.e. a
+Client); it has no effect with net.Resolver.
+*/
+func WithDiagnostics() Option {
+	return func(r *RBL) {
+		r.diagnostics = true
+	}
+}
+
+// WithControlName sets the known-good name ResolverHealthy resolves. DefaultControlName is used if not set.
+func WithControlName(name string) Option {
+	return func(r *RBL) {
+		r.controlName = name
+	}
+}
+
+// WithSentinel sets the address Verify expects to be listed. DefaultSentinel is used if not set.
+func WithSentinel(sentinel net.IP) Option {
+	return func(r *RBL) {
+		r.sentinel = sentinel
+	}
+}
+
+/*
+WithTransitionMapping enables checking IPv6 transition addresses (6to4, Teredo and NAT64)
+by querying their embedded IPv4 address. Results record the original address in MappedFrom.
+*/
+func WithTransitionMapping() Option {
+	return func(r *RBL) {
+		r.mapTransition = true
+	}
+}
+
+// WithEncoder sets the encoder used to build query labels. DefaultEncoder is used if not set.
+func WithEncoder(encoder Encoder) Option {
+	return func(r *RBL) {
+		r.encoder = encoder
+	}
+}
+
+/*
+WithLabelJoin customizes how query names are built for lists that don't use the standard
+"<label>.<zone>" form. The prefix is prepended to the label, and the separator (a single
+dot by default) joins the label and zone. For example,
+
+	NewRBL("dnsbl.example.org", false, WithLabelJoin("ip-", ".v4."))
+
+queries 192.0.2.1 as "ip-1.2.0.192.v4.dnsbl.example.org.".
+*/
+func WithLabelJoin(prefix string, separator string) Option {
+	return func(r *RBL) {
+		r.labelPrefix = prefix
+		r.labelSeparator = separator
+	}
+}
+
+// WithScoreExtractor sets the function used to interpret listed addresses as a score in Result.ScoreValue.
+func WithScoreExtractor(extractor ScoreExtractor) Option {
+	return func(r *RBL) {
+		r.scoreExtractor = extractor
+	}
+}
+
+/*
+WithMaxConcurrency bounds the number of DNS queries the RBL has in flight at once, beneath
+any shared limit (see WithLimiter), so tolerant lists can be queried aggressively and strict
+ones gently. LookupBatch runs up to this many lookups concurrently; without it the batch is
+looked up sequentially.
+*/
+func WithMaxConcurrency(concurrency int) Option {
+	return func(r *RBL) {
+		r.maxConcurrency = concurrency
+	}
+}
+
+// WithLimiter bounds the RBL's concurrent DNS queries using the supplied (possibly shared) limiter.
+func WithLimiter(limiter *Limiter) Option {
+	return func(r *RBL) {
+		r.limiter = limiter
+	}
+}
+
+/*
+WithDialer makes the RBL resolve using Go's built-in resolver, establishing connections to
+nameservers with the supplied dial function. This allows queries to be routed through a
+specific network interface or a proxy. For example, to send queries to 8.8.8.8 through a
+SOCKS5 proxy (which only carries TCP, so queries are made over TCP) using
+golang.org/x/net/proxy:
+
+	socks, _ := proxy.SOCKS5("tcp", "127.0.0.1:1080", nil, proxy.Direct)
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return socks.(proxy.ContextDialer).DialContext(ctx, "tcp", "8.8.8.8:53")
+	}
+	rbl := gorbl.NewRBL("zen.spamhaus.org", true, gorbl.WithDialer(dial))
+
+The query's deadline (including any WithTimeout) is passed to the dial function, and is
+enforced even if the function ignores its context: a connection established too late is
+closed. WithDialer replaces any resolver set by an earlier WithResolver option (and vice versa).
+*/
+func WithDialer(dial func(ctx context.Context, network, address string) (net.Conn, error)) Option {
+	return func(r *RBL) {
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial:     contextDialer(dial),
+		}
+	}
+}
+
+// dialResult is the outcome of a dial performed by contextDialer.
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+/*
+contextDialer wraps the supplied dial function so it returns once its context is done, even
+if the function itself doesn't. Connections it establishes afterwards are closed.
+*/
+func contextDialer(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if ctx.Done() == nil {
+			return dial(ctx, network, address)
+		}
+
+		done := make(chan dialResult, 1)
+		go func() {
+			conn, err := dial(ctx, network, address)
+			done <- dialResult{conn: conn, err: err}
+		}()
+
+		select {
+		case res := <-done:
+			return res.conn, res.err
+		case <-ctx.Done():
+			go func() {
+				if res := <-done; res.conn != nil {
+					res.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
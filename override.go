@@ -0,0 +1,110 @@
+package gorbl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+/*
+Override is a locally maintained verdict for an IP, answered by LookupIP instead of querying
+the RBL (see WithOverrides).
+*/
+type Override struct {
+	// Listed indicates whether the IP is treated as listed
+	Listed bool `json:"listed"`
+	// ListedAddress is the return code reported for a listing; 127.0.0.2 if empty
+	ListedAddress string `json:"listed_address"`
+	// Text is the optional explanation reported for the IP
+	Text string `json:"text"`
+}
+
+// defaultOverrideAddress is the return code reported for overridden listings without one.
+const defaultOverrideAddress = "127.0.0.2"
+
+/*
+ParseOverrides reads a hosts-style override file, with one IP per line followed by either
+"listed" or "clean" and an optional explanation:
+
+	192.0.2.1 listed Known spam source
+	192.0.2.2 clean
+
+A return code may be given for listings as "listed=127.0.0.4". Blank lines and lines
+starting with '#' are ignored.
+*/
+func ParseOverrides(reader io.Reader) (map[string]Override, error) {
+	overrides := map[string]Override{}
+	scanner := bufio.NewScanner(reader)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%w: line %d: expected an IP and a verdict", ErrInvalidInput, line)
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			return nil, fmt.Errorf("%w: line %d: %q is not an IP", ErrInvalidInput, line, fields[0])
+		}
+
+		var override Override
+
+		verdict, code, _ := strings.Cut(fields[1], "=")
+		switch verdict {
+		case "listed":
+			override.Listed = true
+			override.ListedAddress = code
+		case "clean":
+		default:
+			return nil, fmt.Errorf("%w: line %d: unknown verdict %q", ErrInvalidInput, line, fields[1])
+		}
+
+		if len(code) > 0 && net.ParseIP(code) == nil {
+			return nil, fmt.Errorf("%w: line %d: %q is not a return code", ErrInvalidInput, line, code)
+		}
+
+		override.Text = strings.Join(fields[2:], " ")
+		overrides[ip.String()] = override
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// override returns the result overriding the lookup of the supplied IP, if one is configured.
+func (r *RBL) override(ip net.IP) (Result, bool) {
+	override, ok := r.overrides[ip.String()]
+	if !ok {
+		return Result{}, false
+	}
+
+	res := Result{
+		Address:    ip.String(),
+		Zone:       r.hostname,
+		Listed:     override.Listed,
+		Text:       override.Text,
+		FetchedAt:  time.Now(),
+		Overridden: true,
+	}
+
+	if override.Listed {
+		res.ListedAddress = override.ListedAddress
+		if len(res.ListedAddress) == 0 {
+			res.ListedAddress = defaultOverrideAddress
+		}
+		res.RemovalURLTemplate = r.removalURLTemplate
+	}
+
+	return res, true
+}
@@ -0,0 +1,69 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestParseOverrides(t *testing.T) {
+	t.Parallel()
+	overrides, err := ParseOverrides(strings.NewReader(`
+# Local decisions
+192.0.2.1 listed Known spam source
+192.0.2.2 clean
+2001:0db8::1 listed=127.0.0.4
+`))
+	if err != nil {
+		t.Fatalf("Expected no error, actual %v", err)
+	}
+
+	expected := map[string]Override{
+		"192.0.2.1":   {Listed: true, Text: "Known spam source"},
+		"192.0.2.2":   {},
+		"2001:db8::1": {Listed: true, ListedAddress: "127.0.0.4"},
+	}
+	if !reflect.DeepEqual(overrides, expected) {
+		t.Errorf("Expected %+v, actual %+v", expected, overrides)
+	}
+}
+
+func TestParseOverridesInvalid(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{"192.0.2.1", "example.org listed", "192.0.2.1 blocked", "192.0.2.1 listed=bogus"} {
+		if _, err := ParseOverrides(strings.NewReader(input)); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Expected ErrInvalidInput for %q, actual %v", input, err)
+		}
+	}
+}
+
+func TestWithOverrides(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithOverrides(map[string]Override{
+		"192.0.2.1": {Listed: true, Text: "Local block"},
+		"127.0.0.2": {},
+	}))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if r := res.Results[0]; !r.Listed || !r.Overridden || r.ListedAddress != "127.0.0.2" || r.Text != "Local block" {
+		t.Errorf("Expected the overridden listing, actual %+v", r)
+	}
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if r := res.Results[0]; r.Listed || r.Error || !r.Overridden {
+		t.Errorf("Expected the overridden clean verdict, actual %+v", r)
+	}
+
+	if c := mock.hostQueryCount(); c != 0 {
+		t.Errorf("Expected no queries for overridden IPs, actual %d", c)
+	}
+
+	if res = rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.9")); res.IsListed() || res.Results[0].Overridden {
+		t.Errorf("Expected other IPs to be queried, actual %+v", res.Results)
+	}
+}
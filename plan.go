@@ -0,0 +1,73 @@
+package gorbl
+
+import "net"
+
+/*
+Plan returns the names the A queries for looking up the specified IP would be issued
+for (one per zone), without performing any queries. An empty plan means no queries would
+be issued, as the IP can't be encoded, is answered by an override (see WithOverrides) or is
+skipped as private or reserved (see WithSkipUnqueryable). Names exceeding the DNS length
+limits are never sent, so are left out.
+*/
+func (r *RBL) Plan(ip net.IP) []string {
+	if _, ok := r.override(ip); ok {
+		return nil
+	}
+
+	if r.skipUnqueryable && !IsQueryable(ip) {
+		return nil
+	}
+
+	if r.mapTransition {
+		if v4, ok := EmbeddedIPv4(ip); ok {
+			ip = v4
+		}
+	}
+
+	label, err := r.encoderOrDefault().Encode(ip.String())
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, zone := range r.zones() {
+		name := r.queryName(label, zone)
+		if validateName(name) != nil {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
+
+/*
+EstimateQueries returns the number of DNS queries looking up each of the supplied IPs
+would issue. TXT queries (including those of the explanation zone, see WithExplanationZone)
+are only issued for listed IPs, so when either is enabled the estimate assumes every IP is
+listed, giving an upper bound. With WithAAAA an Exchanger issues an AAAA query alongside each
+A query, which is counted too. Queries repeated after a failure (see WithServFailHandling and
+WithGoResolver) aren't.
+*/
+func (r *RBL) EstimateQueries(ips []net.IP) int {
+	perName := 1
+	if _, ok := r.resolver.(Exchanger); ok && r.aaaa {
+		perName++
+	}
+
+	if r.lookupTxt {
+		perName++
+	}
+
+	if len(r.explanationZone) > 0 {
+		perName++
+	}
+
+	total := 0
+	for _, ip := range ips {
+		total += len(r.Plan(ip)) * perName
+	}
+
+	return total
+}
@@ -0,0 +1,140 @@
+package gorbl
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("spamhaus.org", false, WithSubZones("sbl", "pbl"))
+
+	expected := []string{"1.2.0.192.sbl.spamhaus.org.", "1.2.0.192.pbl.spamhaus.org."}
+	if actual := rbl.Plan(net.ParseIP("192.0.2.1")); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, actual %v", expected, actual)
+	}
+
+	if actual := NewRBL("dnsbl.example.org", false, WithEncoder(IPv4Encoder)).Plan(net.ParseIP("2001:db8::1")); len(actual) != 0 {
+		t.Errorf("Expected an empty plan for an unencodable IP, actual %v", actual)
+	}
+}
+
+func TestEstimateQueries(t *testing.T) {
+	t.Parallel()
+	ips := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}
+
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false),
+		NewRBL("b.example.org", true),
+		NewRBL("example.org", true, WithSubZones("c", "d")),
+	})
+
+	// 2 IPs * (1 A + 2 A/TXT + 2 zones * 2 A/TXT)
+	if actual := m.EstimateQueries(ips); actual != 14 {
+		t.Errorf("Expected 14 queries, actual %d", actual)
+	}
+}
+
+func TestPlanLabelJoin(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("dnsbl.example.org", false, WithLabelJoin("ip-", ".v4."))
+
+	expected := []string{"ip-1.2.0.192.v4.dnsbl.example.org."}
+	if actual := rbl.Plan(net.ParseIP("192.0.2.1")); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, actual %v", expected, actual)
+	}
+}
+
+func TestEstimateQueriesExplanationZone(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		txts: map[string][]string{
+			"2.0.0.127.dnsbl.example.org.":   {"Listed"},
+			"2.0.0.127.explain.example.org.": {"Listed for spam"},
+		},
+	}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithExplanationZone("explain.example.org"))
+
+	ips := []net.IP{net.ParseIP("127.0.0.2")}
+	estimate := rbl.EstimateQueries(ips)
+	rbl.LookupIP(context.Background(), ips[0])
+
+	if actual := mock.hostQueryCount() + mock.txtQueryCount(); estimate != actual || actual != 3 {
+		t.Errorf("Expected an estimate of 3 queries matching those sent, estimated %d, actual %d", estimate, actual)
+	}
+}
+
+func TestEstimateQueriesAAAA(t *testing.T) {
+	t.Parallel()
+	var queries atomic.Int32
+	server := startTestServer(t, func(q dnsmessage.Message) dnsmessage.Message {
+		queries.Add(1)
+		return zoneHandler(map[string][4]byte{"2.0.0.127.dnsbl.example.org.": {127, 0, 0, 2}}, nil)(q)
+	})
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(NewClient(server)), WithAAAA())
+
+	ips := []net.IP{net.ParseIP("127.0.0.2")}
+	estimate := rbl.EstimateQueries(ips)
+	rbl.LookupIP(context.Background(), ips[0])
+
+	if actual := int(queries.Load()); estimate != actual || actual != 2 {
+		t.Errorf("Expected an estimate of 2 queries matching those sent, estimated %d, actual %d", estimate, actual)
+	}
+
+	// Other resolvers return AAAA answers from the A lookup.
+	if actual := NewRBL("dnsbl.example.org", false, WithResolver(&mockResolver{}), WithAAAA()).EstimateQueries(ips); actual != 1 {
+		t.Errorf("Expected 1 query without an Exchanger, actual %d", actual)
+	}
+}
+
+func TestPlanOverrides(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithOverrides(map[string]Override{"192.0.2.1": {Listed: true}}))
+
+	ips := []net.IP{net.ParseIP("192.0.2.1")}
+	if plan := rbl.Plan(ips[0]); len(plan) != 0 {
+		t.Errorf("Expected an empty plan for an overridden IP, actual %v", plan)
+	}
+
+	estimate := rbl.EstimateQueries(ips)
+	rbl.LookupIP(context.Background(), ips[0])
+
+	if actual := mock.hostQueryCount() + mock.txtQueryCount(); estimate != 0 || actual != 0 {
+		t.Errorf("Expected no queries for an overridden IP, estimated %d, actual %d", estimate, actual)
+	}
+}
+
+func TestPlanUnsentQueries(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithSkipUnqueryable())
+
+	// The IPv6 label alone is 63 octets, so the zone pushes the name past the 253 octet limit.
+	long := NewRBL(strings.Repeat("a.", 95)+"example.org", false, WithResolver(mock))
+
+	ips := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("192.168.1.1")}
+	estimate := rbl.EstimateQueries(ips)
+	for _, ip := range ips {
+		rbl.LookupIP(context.Background(), ip)
+	}
+
+	v6 := []net.IP{net.ParseIP("2001:db8::1")}
+	estimate += long.EstimateQueries(v6)
+	long.LookupIP(context.Background(), v6[0])
+
+	if actual := mock.hostQueryCount(); estimate != 0 || actual != 0 {
+		t.Errorf("Expected no queries for skipped IPs or overlong names, estimated %d, actual %d", estimate, actual)
+	}
+
+	if estimate := rbl.EstimateQueries([]net.IP{net.ParseIP("8.8.8.8")}); estimate != 1 {
+		t.Errorf("Expected public IPs to be counted, actual %d", estimate)
+	}
+}
@@ -0,0 +1,121 @@
+package gorbl
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// queueJob is a lookup submitted to a Queue, along with where to deliver its results.
+type queueJob struct {
+	ctx     context.Context
+	ip      net.IP
+	results chan []RBLResults
+}
+
+/*
+Queue applies backpressure to lookups against a MultiRBL: submissions are held in a bounded
+queue and processed by a fixed pool of workers, so a service receiving requests faster than
+DNS can answer them never grows an unbounded number of goroutines. When the queue is full,
+Submit blocks while TrySubmit rejects the submission.
+
+A Queue is safe for concurrent use; Close stops it once the queued lookups complete.
+*/
+type Queue struct {
+	multi *MultiRBL
+	jobs  chan queueJob
+	wg    sync.WaitGroup
+
+	// mu guards closed, and prevents jobs being closed while a submission is in progress.
+	mu     sync.RWMutex
+	closed bool
+}
+
+/*
+NewQueue creates a Queue performing lookups against the supplied MultiRBL using the supplied
+number of workers, holding up to size submissions waiting for a worker.
+*/
+func NewQueue(multi *MultiRBL, workers int, size int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if size < 0 {
+		size = 0
+	}
+
+	q := &Queue{
+		multi: multi,
+		jobs:  make(chan queueJob, size),
+	}
+
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+/*
+Submit queues a lookup of the supplied IP, blocking while the queue is full. The returned
+channel receives the results once a worker completes the lookup, which is subject to the
+supplied context. The context's error is returned if it is done before the lookup is queued.
+*/
+func (q *Queue) Submit(ctx context.Context, ip net.IP) (<-chan []RBLResults, error) {
+	return q.submit(ctx, ip, true)
+}
+
+// TrySubmit queues a lookup of the supplied IP as Submit does, returning ErrQueueFull rather than blocking if the queue is full.
+func (q *Queue) TrySubmit(ctx context.Context, ip net.IP) (<-chan []RBLResults, error) {
+	return q.submit(ctx, ip, false)
+}
+
+// submit queues a lookup of the supplied IP, optionally blocking until there is room.
+func (q *Queue) submit(ctx context.Context, ip net.IP, block bool) (<-chan []RBLResults, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+
+	job := queueJob{ctx: ctx, ip: ip, results: make(chan []RBLResults, 1)}
+
+	if !block {
+		select {
+		case q.jobs <- job:
+			return job.results, nil
+		default:
+			return nil, ErrQueueFull
+		}
+	}
+
+	select {
+	case q.jobs <- job:
+		return job.results, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops accepting submissions and waits for the queued lookups to complete.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+// work performs queued lookups until the queue is closed.
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for job := range q.jobs {
+		job.results <- q.multi.LookupIP(job.ctx, job.ip)
+	}
+}
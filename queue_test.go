@@ -0,0 +1,73 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	q := NewQueue(NewMultiRBL([]Lookuper{NewRBL("dnsbl.example.org", false, WithResolver(mock))}), 2, 4)
+
+	var pending []<-chan []RBLResults
+	for i := 0; i < 10; i++ {
+		results, err := q.Submit(context.Background(), net.ParseIP("127.0.0.2"))
+		if err != nil {
+			t.Fatalf("Expected no error, actual %v", err)
+		}
+		pending = append(pending, results)
+	}
+
+	for _, results := range pending {
+		if rets := <-results; len(rets) != 1 || !rets[0].IsListed() {
+			t.Errorf("Expected a listing, actual %+v", rets)
+		}
+	}
+
+	q.Close()
+	if _, err := q.Submit(context.Background(), net.ParseIP("127.0.0.2")); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected ErrQueueClosed, actual %v", err)
+	}
+}
+
+func TestQueueBackpressure(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{delay: time.Millisecond * 200}
+	q := NewQueue(NewMultiRBL([]Lookuper{NewRBL("dnsbl.example.org", false, WithResolver(mock))}), 1, 1)
+	defer q.Close()
+
+	// Once the worker takes the first lookup, the second fills the queue.
+	if _, err := q.Submit(context.Background(), net.ParseIP("192.0.2.1")); err != nil {
+		t.Fatalf("Expected no error, actual %v", err)
+	}
+
+	for mock.hostQueryCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := q.TrySubmit(context.Background(), net.ParseIP("192.0.2.2")); err != nil {
+		t.Fatalf("Expected room for a single queued lookup, actual %v", err)
+	}
+
+	if _, err := q.TrySubmit(context.Background(), net.ParseIP("192.0.2.2")); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, actual %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	if _, err := q.Submit(ctx, net.ParseIP("192.0.2.3")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Submit to block until the deadline, actual %v", err)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if mock.maxInFlight > 1 {
+		t.Errorf("Expected at most one lookup in flight, actual %d", mock.maxInFlight)
+	}
+}
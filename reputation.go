@@ -0,0 +1,199 @@
+package gorbl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+Verdict is the final decision reached about a host or IP by a PolicyFunc.
+*/
+type Verdict int
+
+const (
+	// Allow indicates the host or IP should be accepted.
+	Allow Verdict = iota
+	// Greylist indicates the host or IP should be temporarily deferred.
+	Greylist
+	// Block indicates the host or IP should be rejected.
+	Block
+	// Uncertain indicates too many lists failed to answer for a verdict to be trusted (see EvaluateWithAbstentions).
+	Uncertain
+)
+
+// String returns the lowercase name of the verdict.
+func (v Verdict) String() string {
+	switch v {
+	case Allow:
+		return "allow"
+	case Greylist:
+		return "greylist"
+	case Block:
+		return "block"
+	case Uncertain:
+		return "uncertain"
+	}
+
+	return "unknown"
+}
+
+/*
+Reputation summarizes the results of looking up a host or IP across many lists.
+*/
+type Reputation struct {
+	// ListsQueried is the number of lists results were supplied for
+	ListsQueried int `json:"lists_queried"`
+	// ListsHit is the number of (non-whitelist) lists the host or IP was listed on
+	ListsHit int `json:"lists_hit"`
+	// ListedOn holds the names of the (non-whitelist) lists the host or IP was listed on, sorted
+	ListedOn []string `json:"listed_on"`
+	// WhitelistsHit is the number of whitelists the host or IP was listed on
+	WhitelistsHit int `json:"whitelists_hit"`
+	// ListsAbstained is the number of lists that failed to answer (and reported no listing);
+	// they count neither for nor against the host or IP
+	ListsAbstained int `json:"lists_abstained"`
+	// AbstentionRate is the fraction of the lists queried that abstained
+	AbstentionRate float64 `json:"abstention_rate"`
+	// Confidence is how trustworthy the verdict is, between 0 and 1 (see Evaluate)
+	Confidence float64 `json:"confidence"`
+	// Verdict is the decision reached by the policy
+	Verdict Verdict `json:"verdict"`
+}
+
+/*
+String returns a one-line summary of the reputation for logging and alerts, such as
+"LISTED on 3/12 lists (a.example.org, b.example.org, c.example.org)" or "CLEAN on 0/12 lists".
+Lists that failed to answer are noted (i.e. "CLEAN on 0/12 lists, 2 unanswered").
+*/
+func (rep Reputation) String() string {
+	var b strings.Builder
+
+	if rep.ListsHit > 0 {
+		fmt.Fprintf(&b, "LISTED on %d/%d lists (%s)", rep.ListsHit, rep.ListsQueried, strings.Join(rep.ListedOn, ", "))
+	} else {
+		fmt.Fprintf(&b, "CLEAN on 0/%d lists", rep.ListsQueried)
+	}
+
+	if rep.ListsAbstained > 0 {
+		fmt.Fprintf(&b, ", %d unanswered", rep.ListsAbstained)
+	}
+
+	return b.String()
+}
+
+/*
+PolicyFunc derives a verdict from a reputation summary. The Verdict field of the
+supplied Reputation is not yet set when the policy is called.
+*/
+type PolicyFunc func(rep Reputation) Verdict
+
+/*
+DefaultPolicy allows anything on a whitelist, blocks anything on two or more lists,
+greylists anything on a single list and allows everything else.
+*/
+func DefaultPolicy(rep Reputation) Verdict {
+	switch {
+	case rep.WhitelistsHit > 0:
+		return Allow
+	case rep.ListsHit > 1:
+		return Block
+	case rep.ListsHit == 1:
+		return Greylist
+	}
+
+	return Allow
+}
+
+/*
+Evaluate summarizes the supplied results (one RBLResults per list queried) and derives a
+verdict using the supplied policy. DefaultPolicy is used if policy is nil.
+
+The confidence of the verdict is the weight of the lists that answered as a fraction of the
+weight of every list queried:
+
+	Confidence = Σ weight(answered) / Σ weight(queried)
+
+where a list's weight is RBLResults.Weight, or 1 if it isn't positive. A list answered
+unless it abstained (a listing counts as an answer even if another query failed). The
+confidence is 0 if no lists were queried.
+*/
+func Evaluate(results []RBLResults, policy PolicyFunc) Reputation {
+	if policy == nil {
+		policy = DefaultPolicy
+	}
+
+	rep := Reputation{
+		ListsQueried: len(results),
+	}
+
+	var answered, total float64
+
+	for _, res := range results {
+		weight := listWeight(res)
+		total += weight
+
+		if !res.IsListed() {
+			if abstained(res) {
+				rep.ListsAbstained++
+			} else {
+				answered += weight
+			}
+			continue
+		}
+
+		answered += weight
+
+		if res.Whitelist {
+			rep.WhitelistsHit++
+		} else {
+			rep.ListsHit++
+			rep.ListedOn = append(rep.ListedOn, res.List)
+		}
+	}
+
+	sort.Strings(rep.ListedOn)
+
+	if rep.ListsQueried > 0 {
+		rep.AbstentionRate = float64(rep.ListsAbstained) / float64(rep.ListsQueried)
+		rep.Confidence = answered / total
+	}
+
+	rep.Verdict = policy(rep)
+	return rep
+}
+
+/*
+EvaluateWithAbstentions behaves as Evaluate, but reports an Uncertain verdict if more than
+maxAbstentionRate (between 0 and 1) of the lists abstained, rather than treating the lists
+that failed to answer as clean. A Block verdict reached from the lists that did answer stands.
+*/
+func EvaluateWithAbstentions(results []RBLResults, policy PolicyFunc, maxAbstentionRate float64) Reputation {
+	rep := Evaluate(results, policy)
+
+	if rep.AbstentionRate > maxAbstentionRate && rep.Verdict != Block {
+		rep.Verdict = Uncertain
+	}
+
+	return rep
+}
+
+// abstained returns true if any query of the supplied (unlisted) results failed, leaving the list's answer unknown.
+func abstained(results RBLResults) bool {
+	for _, res := range results.Results {
+		if res.Failed() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listWeight returns the weight of the list the supplied results are from, or 1 if it isn't positive.
+func listWeight(results RBLResults) float64 {
+	if results.Weight <= 0 {
+		return 1
+	}
+
+	return results.Weight
+}
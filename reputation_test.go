@@ -0,0 +1,155 @@
+package gorbl
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func listedResults(list string, whitelist bool, listed bool) RBLResults {
+	return RBLResults{
+		List:      list,
+		Whitelist: whitelist,
+		Results:   []Result{{Address: "192.0.2.1", Listed: listed}},
+	}
+}
+
+func TestEvaluateDefaultPolicy(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		results  []RBLResults
+		expected Verdict
+	}{
+		{[]RBLResults{listedResults("a", false, false), listedResults("b", false, false)}, Allow},
+		{[]RBLResults{listedResults("a", false, true), listedResults("b", false, false)}, Greylist},
+		{[]RBLResults{listedResults("a", false, true), listedResults("b", false, true)}, Block},
+		{[]RBLResults{listedResults("a", false, true), listedResults("b", false, true), listedResults("w", true, true)}, Allow},
+	}
+
+	for _, c := range cases {
+		rep := Evaluate(c.results, nil)
+		if rep.Verdict != c.expected {
+			t.Errorf("Expected %s, actual %s (%+v)", c.expected, rep.Verdict, rep)
+		}
+	}
+}
+
+func TestEvaluateCounts(t *testing.T) {
+	t.Parallel()
+	results := []RBLResults{
+		listedResults("a", false, true),
+		listedResults("b", false, false),
+		listedResults("w", true, true),
+	}
+
+	var seen Reputation
+	rep := Evaluate(results, func(r Reputation) Verdict {
+		seen = r
+		return Block
+	})
+
+	if rep.ListsQueried != 3 || rep.ListsHit != 1 || rep.WhitelistsHit != 1 {
+		t.Errorf("Expected 3 queried, 1 hit, 1 whitelist hit, actual %+v", rep)
+	}
+
+	if seen.ListsHit != 1 || rep.Verdict != Block {
+		t.Errorf("Expected the policy to see the summary and decide the verdict, actual %+v", rep)
+	}
+}
+
+func TestEvaluateWithAbstentions(t *testing.T) {
+	t.Parallel()
+	failed := RBLResults{
+		List:    "down",
+		Results: []Result{{Address: "192.0.2.1", Error: true, ErrorType: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}},
+	}
+	notFound := RBLResults{
+		List:    "clean",
+		Results: []Result{{Address: "192.0.2.1", Error: true, ErrorType: &net.DNSError{Err: "no such host", IsNotFound: true}}},
+	}
+
+	results := []RBLResults{failed, failed, notFound, listedResults("a", false, false)}
+
+	rep := Evaluate(results, nil)
+	if rep.ListsAbstained != 2 || rep.AbstentionRate != 0.5 || rep.Verdict != Allow {
+		t.Errorf("Expected 2 abstentions with an allow verdict, actual %+v", rep)
+	}
+
+	if rep := EvaluateWithAbstentions(results, nil, 0.25); rep.Verdict != Uncertain || rep.Verdict.String() != "uncertain" {
+		t.Errorf("Expected an uncertain verdict, actual %+v", rep)
+	}
+
+	if rep := EvaluateWithAbstentions(results, nil, 0.5); rep.Verdict != Allow {
+		t.Errorf("Expected the verdict to stand within the threshold, actual %+v", rep)
+	}
+
+	blocked := append(results, listedResults("b", false, true), listedResults("c", false, true))
+	if rep := EvaluateWithAbstentions(blocked, nil, 0); rep.Verdict != Block {
+		t.Errorf("Expected a block from the answering lists to stand, actual %+v", rep)
+	}
+}
+
+func TestReputationString(t *testing.T) {
+	t.Parallel()
+	failed := RBLResults{
+		List:    "down.example.org",
+		Results: []Result{{Address: "192.0.2.1", Error: true, ErrorType: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}},
+	}
+
+	cases := []struct {
+		results  []RBLResults
+		expected string
+	}{
+		{
+			[]RBLResults{listedResults("c.example.org", false, true), listedResults("a.example.org", false, true), listedResults("b.example.org", false, false), listedResults("w.example.org", true, true)},
+			"LISTED on 2/4 lists (a.example.org, c.example.org)",
+		},
+		{[]RBLResults{listedResults("a.example.org", false, false), failed}, "CLEAN on 0/2 lists, 1 unanswered"},
+		{nil, "CLEAN on 0/0 lists"},
+	}
+
+	for _, c := range cases {
+		if actual := Evaluate(c.results, nil).String(); actual != c.expected {
+			t.Errorf("Expected %q, actual %q", c.expected, actual)
+		}
+	}
+}
+
+func TestEvaluateConfidence(t *testing.T) {
+	t.Parallel()
+	failed := RBLResults{List: "f", Results: []Result{{Address: "192.0.2.1", Error: true, ErrorType: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}}}
+	weighted := func(rr RBLResults, weight float64) RBLResults {
+		rr.Weight = weight
+		return rr
+	}
+
+	cases := []struct {
+		results  []RBLResults
+		expected float64
+	}{
+		{nil, 0},
+		// Every list answered.
+		{[]RBLResults{listedResults("a", false, true), listedResults("b", false, false), listedResults("c", false, false)}, 1},
+		// Most lists abstained.
+		{[]RBLResults{listedResults("a", false, true), failed, failed, failed}, 0.25},
+		// Weights shift the confidence towards the trusted lists.
+		{[]RBLResults{weighted(listedResults("a", false, true), 3), failed}, 0.75},
+		{[]RBLResults{listedResults("a", false, true), weighted(failed, 3)}, 0.25},
+	}
+
+	for _, c := range cases {
+		if rep := Evaluate(c.results, nil); rep.Confidence != c.expected {
+			t.Errorf("Expected confidence %v, actual %v (%+v)", c.expected, rep.Confidence, rep)
+		}
+	}
+}
+
+func TestWithWeight(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(&mockResolver{}), WithWeight(2.5))
+
+	if res := rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1")); res.Weight != 2.5 {
+		t.Errorf("Expected the list's weight on its results, actual %v", res.Weight)
+	}
+}
@@ -0,0 +1,75 @@
+package gorbl
+
+import "net"
+
+/*
+reservedNets are the IPv4 and IPv6 ranges that are never routed on the public internet, and
+so are never listed: private, loopback, link-local, shared (CGNAT), documentation,
+benchmarking, multicast and other special-purpose ranges.
+*/
+var reservedNets = mustParseCIDRs(
+	// IPv4
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	// IPv6
+	"::/128",
+	"::1/128",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// mustParseCIDRs parses the supplied CIDR ranges, panicking if any are invalid.
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets
+}
+
+/*
+IsQueryable returns true if the supplied IP is worth looking up in an RBL: false for private
+(RFC 1918 and unique local), loopback, link-local, shared, documentation, multicast and other
+reserved IPv4 and IPv6 addresses, which are never listed. Querying them wastes queries and
+may disclose internal addressing to the RBL operator. IPv4-mapped IPv6 addresses are checked
+as IPv4.
+
+Note the conventional DNSBL test points (i.e. 127.0.0.2) are loopback addresses, and so aren't queryable.
+*/
+func IsQueryable(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,68 @@
+package gorbl
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestIsQueryable(t *testing.T) {
+	t.Parallel()
+	cases := map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"::ffff:8.8.8.8":  true,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"127.0.0.2":       false,
+		"169.254.1.1":     false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"224.0.0.1":       false,
+		"255.255.255.255": false,
+		"::ffff:10.0.0.1": false,
+		"::1":             false,
+		"::":              false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"ff02::1":         false,
+		"2001:db8::1":     false,
+		"203.0.113.7":     false,
+		"172.32.0.1":      true,
+		"fc00::1":         false,
+		"not an ip":       false,
+	}
+
+	for addr, expected := range cases {
+		if actual := IsQueryable(net.ParseIP(addr)); actual != expected {
+			t.Errorf("Expected %t for %s, actual %t", expected, addr, actual)
+		}
+	}
+}
+
+func TestWithSkipUnqueryable(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"1.1.168.192.dnsbl.example.org.": {"127.0.0.2"}}}
+
+	res := NewRBL("dnsbl.example.org", false, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("192.168.1.1"))
+	if !res.IsListed() || res.Results[0].Skipped {
+		t.Errorf("Expected private IPs to be queried by default, actual %+v", res.Results)
+	}
+
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithSkipUnqueryable())
+	res = rbl.LookupIP(context.Background(), net.ParseIP("192.168.1.1"))
+	if r := res.Results[0]; r.Listed || r.Error || !r.Skipped {
+		t.Errorf("Expected the private IP to be skipped, actual %+v", r)
+	}
+
+	if c := mock.hostQueryCount(); c != 1 {
+		t.Errorf("Expected the skipped IP not to be queried, actual %d queries", c)
+	}
+
+	rbl.LookupIP(context.Background(), net.ParseIP("8.8.8.8"))
+	if c := mock.hostQueryCount(); c != 2 {
+		t.Errorf("Expected public IPs to be queried, actual %d queries", c)
+	}
+}
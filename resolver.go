@@ -0,0 +1,175 @@
+package gorbl
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/*
+Resolver performs the DNS lookups required by an RBL. *net.Resolver satisfies it;
+alternative implementations can be supplied using WithResolver.
+*/
+type Resolver interface {
+	// LookupHost returns the addresses the supplied host resolves to.
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	// LookupTXT returns the TXT records for the supplied name.
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	// LookupIPAddr returns the IP addresses of the supplied host.
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+var _ Resolver = (*net.Resolver)(nil)
+
+// answer holds the addresses returned for a query along with any exchange details exposed by the resolver.
+type answer struct {
+	// addrs are the addresses returned
+	addrs []string
+	// server is the nameserver that answered, if known
+	server string
+	// meta holds the details of the response, if recorded
+	meta *ResponseMeta
+	// diag holds the wire details of the exchange, if recorded
+	diag *Diagnostics
+}
+
+/*
+ResponseMeta holds details of the DNS response a Result was derived from, for auditing.
+When AAAA answers are enabled (see WithAAAA) it describes the A response.
+*/
+type ResponseMeta struct {
+	// RCode is the response code (i.e. NXDOMAIN is dnsmessage.RCodeNameError)
+	RCode dnsmessage.RCode `json:"rcode"`
+	// Answers is the number of records in the answer section
+	Answers int `json:"answers"`
+	// Authoritative indicates the answering server is authoritative for the zone
+	Authoritative bool `json:"authoritative"`
+}
+
+// lookupHost performs the A lookup of the supplied name, using the advanced resolver path if available.
+func (r *RBL) lookupHost(ctx context.Context, name string) (answer, error) {
+	exchanger, ok := r.resolver.(Exchanger)
+	if !ok {
+		addrs, err := r.resolver.LookupHost(ctx, name)
+		if !r.aaaa {
+			addrs = ipv4Only(addrs)
+		}
+		return answer{addrs: addrs}, err
+	}
+
+	ans, err := exchangeAddrs(ctx, exchanger, name, dnsmessage.TypeA)
+	if !r.responseMeta {
+		ans.meta = nil
+	}
+
+	if !r.diagnostics {
+		ans.diag = nil
+	}
+
+	if !r.aaaa {
+		return ans, err
+	}
+
+	// AAAA answers supplement the standard A answers; if either found records the name exists.
+	extra, extraErr := exchangeAddrs(ctx, exchanger, name, dnsmessage.TypeAAAA)
+	ans.addrs = append(ans.addrs, extra.addrs...)
+	if len(ans.server) == 0 {
+		ans.server = extra.server
+	}
+
+	switch {
+	case len(extra.addrs) > 0 && isNotFound(err):
+		err = nil
+	case len(ans.addrs) == 0 && err == nil:
+		err = extraErr
+	}
+
+	return ans, err
+}
+
+// exchangeAddrs performs a single A or AAAA exchange, returning the addresses answered.
+func exchangeAddrs(ctx context.Context, exchanger Exchanger, name string, qtype dnsmessage.Type) (answer, error) {
+	resp, err := exchanger.Exchange(ctx, name, qtype)
+	if resp == nil {
+		return answer{}, err
+	}
+
+	diag := resp.Diagnostics
+	ans := answer{
+		server: resp.Server,
+		diag:   &diag,
+		meta: &ResponseMeta{
+			RCode:         resp.Message.Header.RCode,
+			Answers:       len(resp.Message.Answers),
+			Authoritative: resp.Message.Header.Authoritative,
+		},
+	}
+	for _, rr := range answers(resp.Message, qtype) {
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			ans.addrs = append(ans.addrs, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			ans.addrs = append(ans.addrs, net.IP(body.AAAA[:]).String())
+		}
+	}
+
+	if err == nil && len(ans.addrs) == 0 {
+		err = noAnswerError(name, resp.Server)
+	}
+
+	return ans, err
+}
+
+// ipv4Only returns the IPv4 addresses of those supplied; resolvers such as net.Resolver also return AAAA answers.
+func ipv4Only(addrs []string) []string {
+	var v4 []string
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+			v4 = append(v4, addr)
+		}
+	}
+
+	return v4
+}
+
+/*
+retransmitResolver repeats lookups that time out, up to retransmits more times while the
+query's context allows. Go's resolver reads its own attempt count from resolv.conf, which
+can't be set per resolver.
+*/
+type retransmitResolver struct {
+	Resolver
+	// retransmits is the number of times a timed out lookup is repeated
+	retransmits int
+}
+
+// LookupHost returns the addresses the supplied host resolves to, repeating lookups that time out.
+func (r *retransmitResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, err := r.Resolver.LookupHost(ctx, host)
+	for attempt := 0; attempt < r.retransmits && isTimeout(err) && ctx.Err() == nil; attempt++ {
+		addrs, err = r.Resolver.LookupHost(ctx, host)
+	}
+
+	return addrs, err
+}
+
+// LookupTXT returns the TXT records for the supplied name, repeating lookups that time out.
+func (r *retransmitResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	txts, err := r.Resolver.LookupTXT(ctx, name)
+	for attempt := 0; attempt < r.retransmits && isTimeout(err) && ctx.Err() == nil; attempt++ {
+		txts, err = r.Resolver.LookupTXT(ctx, name)
+	}
+
+	return txts, err
+}
+
+// LookupIPAddr returns the IP addresses of the supplied host, repeating lookups that time out.
+func (r *retransmitResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, err := r.Resolver.LookupIPAddr(ctx, host)
+	for attempt := 0; attempt < r.retransmits && isTimeout(err) && ctx.Err() == nil; attempt++ {
+		addrs, err = r.Resolver.LookupIPAddr(ctx, host)
+	}
+
+	return addrs, err
+}
@@ -0,0 +1,527 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mockResolver is a Resolver answering from static maps, recording the queries it receives.
+type mockResolver struct {
+	hosts map[string][]string
+	txts  map[string][]string
+	ips   map[string][]net.IPAddr
+	errs  map[string]error
+	// delay is applied to every LookupHost call, returning early with the context's error if it is done.
+	delay time.Duration
+	// txtDelay is applied to every LookupTXT call in the same way.
+	txtDelay time.Duration
+
+	mu          sync.Mutex
+	hostQueries []string
+	txtQueries  []string
+	inFlight    int
+	maxInFlight int
+}
+
+func (m *mockResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	m.mu.Lock()
+	m.hostQueries = append(m.hostQueries, host)
+	m.inFlight++
+	m.maxInFlight = max(m.maxInFlight, m.inFlight)
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		m.inFlight--
+		m.mu.Unlock()
+	}()
+
+	if m.delay > 0 {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if err, ok := m.errs[host]; ok {
+		return nil, err
+	}
+
+	if addrs, ok := m.hosts[host]; ok {
+		return addrs, nil
+	}
+
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (m *mockResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	m.mu.Lock()
+	m.txtQueries = append(m.txtQueries, name)
+	m.mu.Unlock()
+
+	if m.txtDelay > 0 {
+		select {
+		case <-time.After(m.txtDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if txt, ok := m.txts[name]; ok {
+		return txt, nil
+	}
+
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (m *mockResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if addrs, ok := m.ips[host]; ok {
+		return addrs, nil
+	}
+
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (m *mockResolver) txtQueryCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.txtQueries)
+}
+
+func (m *mockResolver) hostQueryCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.hostQueries)
+}
+
+func TestLookupIPNotListedSkipsTXT(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+
+	if len(res.Results) != 1 || res.Results[0].Listed || res.Results[0].TxtQueried {
+		t.Errorf("Expected a single not-listed result without TXT, actual %+v", res.Results)
+	}
+
+	if c := mock.txtQueryCount(); c != 0 {
+		t.Errorf("Expected no TXT queries for a not-listed IP, actual %d", c)
+	}
+}
+
+func TestLookupIPListedQueriesTXTOnce(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2", "127.0.0.4"}},
+		txts:  map[string][]string{"2.0.0.127.dnsbl.example.org.": {"Listed for spam"}},
+	}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	if len(res.Results) != 2 {
+		t.Fatalf("Expected 2 results, actual %d", len(res.Results))
+	}
+
+	for _, r := range res.Results {
+		if !r.Listed || r.Text != "Listed for spam" || !r.TxtQueried {
+			t.Errorf("Expected a listed result with TXT, actual %+v", r)
+		}
+	}
+
+	if c := mock.txtQueryCount(); c != 1 {
+		t.Errorf("Expected a single TXT query, actual %d", c)
+	}
+}
+
+func TestLookupIPTxtQueriedWithoutRecord(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+	}
+
+	res := NewRBL("dnsbl.example.org", true, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if !res.Results[0].TxtQueried || res.Results[0].Text != "" {
+		t.Errorf("Expected a TXT query with no text, actual %+v", res.Results[0])
+	}
+
+	res = NewRBL("dnsbl.example.org", false, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.Results[0].TxtQueried {
+		t.Errorf("Expected no TXT query when disabled, actual %+v", res.Results[0])
+	}
+}
+
+func TestWithDialer(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, zoneHandler(map[string][4]byte{"2.0.0.127.dnsbl.example.org.": {127, 0, 0, 2}}, nil))
+
+	var (
+		mu    sync.Mutex
+		dials int
+	)
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		mu.Lock()
+		dials++
+		mu.Unlock()
+
+		var d net.Dialer
+		return d.DialContext(ctx, network, server)
+	}
+
+	rbl := NewRBL("dnsbl.example.org", false, WithDialer(dial))
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+
+	if len(res.Results) != 1 || !res.Results[0].Listed {
+		t.Errorf("Expected a listing via the custom dialer, actual %+v", res.Results)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if dials == 0 {
+		t.Errorf("Expected the custom dialer to be used")
+	}
+}
+
+func TestWithGoResolver(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("dnsbl.example.org", false, WithGoResolver(2))
+
+	retransmitting, ok := rbl.resolver.(*retransmitResolver)
+	if !ok || retransmitting.retransmits != 2 {
+		t.Fatalf("Expected a resolver retransmitting twice, actual %+v", rbl.resolver)
+	}
+
+	if goResolver, ok := retransmitting.Resolver.(*net.Resolver); !ok || !goResolver.PreferGo {
+		t.Errorf("Expected the pure Go resolver, actual %+v", retransmitting.Resolver)
+	}
+}
+
+func TestRetransmitResolver(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		errs: map[string]error{
+			"1.2.0.192.dnsbl.example.org.": &net.DNSError{Err: "i/o timeout", IsTimeout: true},
+			"2.2.0.192.dnsbl.example.org.": &net.DNSError{Err: "server misbehaving"},
+		},
+	}
+	resolver := &retransmitResolver{Resolver: mock, retransmits: 2}
+
+	if _, err := resolver.LookupHost(context.Background(), "1.2.0.192.dnsbl.example.org."); err == nil {
+		t.Errorf("Expected the timeout to be reported")
+	}
+
+	if count := mock.hostQueryCount(); count != 3 {
+		t.Errorf("Expected 3 queries for a timed out lookup, actual %d", count)
+	}
+
+	resolver.LookupHost(context.Background(), "2.2.0.192.dnsbl.example.org.")
+	resolver.LookupHost(context.Background(), "2.0.0.127.dnsbl.example.org.")
+
+	if count := mock.hostQueryCount(); count != 5 {
+		t.Errorf("Expected other lookups not to be repeated, actual %d queries", count)
+	}
+}
+
+func TestWithDeduplicationCallerCancels(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		delay: time.Millisecond * 100,
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithDeduplication())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan RBLResults, 1)
+	go func() {
+		first <- rbl.LookupIP(ctx, net.ParseIP("127.0.0.2"))
+	}()
+
+	// Wait for the first caller's query to be in flight before joining it.
+	for mock.hostQueryCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	second := make(chan RBLResults, 1)
+	go func() {
+		second <- rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+	cancel()
+
+	if res := <-first; len(res.Results) != 1 || !errors.Is(res.Results[0].ErrorType, context.Canceled) {
+		t.Errorf("Expected the cancelled caller to fail, actual %+v", res.Results)
+	}
+
+	if res := <-second; !res.IsListed() {
+		t.Errorf("Expected the second caller to receive the shared listing, actual %+v", res.Results)
+	}
+
+	if c := mock.hostQueryCount(); c != 1 {
+		t.Errorf("Expected a single shared query, actual %d", c)
+	}
+}
+
+func TestWithAAAA(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2", "2001:db8::2"}},
+	}
+
+	res := NewRBL("dnsbl.example.org", false, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(res.Results) != 1 || res.Results[0].ListedAddress != "127.0.0.2" {
+		t.Errorf("Expected AAAA answers to be ignored by default, actual %+v", res.Results)
+	}
+
+	res = NewRBL("dnsbl.example.org", false, WithResolver(mock), WithAAAA()).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(res.Results) != 2 || !res.Results[1].Listed || res.Results[1].ListedAddress != "2001:db8::2" {
+		t.Errorf("Expected the AAAA answer to be included, actual %+v", res.Results)
+	}
+}
+
+func TestWithAAAAExchanger(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, func(q dnsmessage.Message) dnsmessage.Message {
+		question := q.Questions[0]
+		if question.Type != dnsmessage.TypeAAAA {
+			return dnsmessage.Message{Header: dnsmessage.Header{RCode: dnsmessage.RCodeNameError}}
+		}
+
+		hdr := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60}
+		aaaa := [16]byte(net.ParseIP("2001:db8::7"))
+		return dnsmessage.Message{Answers: []dnsmessage.Resource{{Header: hdr, Body: &dnsmessage.AAAAResource{AAAA: aaaa}}}}
+	})
+
+	res := NewRBL("dnsbl.example.org", false, WithResolver(NewClient(server))).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.IsListed() {
+		t.Errorf("Expected no AAAA query by default, actual %+v", res.Results)
+	}
+
+	res = NewRBL("dnsbl.example.org", false, WithResolver(NewClient(server)), WithAAAA()).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(res.Results) != 1 || !res.Results[0].Listed || res.Results[0].Error || res.Results[0].ListedAddress != "2001:db8::7" {
+		t.Errorf("Expected the AAAA answer to be reported as a listing, actual %+v", res.Results)
+	}
+}
+
+func TestWithTxtCodes(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{
+			"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"},
+			"4.0.0.127.dnsbl.example.org.": {"127.0.0.4"},
+		},
+		txts: map[string][]string{
+			"2.0.0.127.dnsbl.example.org.": {"Listed for spam"},
+			"4.0.0.127.dnsbl.example.org.": {"Listed as exploited"},
+		},
+	}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithTxtCodes("127.0.0.4"))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if !res.Results[0].Listed || res.Results[0].TxtQueried {
+		t.Errorf("Expected a listing without TXT for an unwanted code, actual %+v", res.Results)
+	}
+
+	res = rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.4"))
+	if !res.Results[0].TxtQueried || res.Results[0].Text != "Listed as exploited" {
+		t.Errorf("Expected the TXT record for a wanted code, actual %+v", res.Results)
+	}
+
+	if c := mock.txtQueryCount(); c != 1 {
+		t.Errorf("Expected a single TXT query, actual %d", c)
+	}
+}
+
+func TestLookupIPTxtTimeoutKeepsListing(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts:    map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		txts:     map[string][]string{"2.0.0.127.dnsbl.example.org.": {"Listed for spam"}},
+		txtDelay: time.Second * 5,
+	}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithTimeout(time.Millisecond*50))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(res.Results) != 1 {
+		t.Fatalf("Expected a single result, actual %+v", res.Results)
+	}
+
+	if r := res.Results[0]; !r.Listed || r.Error || !r.TxtQueried || !r.TxtTimeout || len(r.Text) > 0 {
+		t.Errorf("Expected a listing with the TXT timeout noted, actual %+v", r)
+	}
+
+	// A missing TXT record isn't a timeout.
+	mock.txtDelay = 0
+	delete(mock.txts, "2.0.0.127.dnsbl.example.org.")
+
+	if r := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")).Results[0]; !r.Listed || r.TxtTimeout {
+		t.Errorf("Expected a listing without a TXT timeout, actual %+v", r)
+	}
+}
+
+func TestWithFirstSeenExtractor(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		txts:  map[string][]string{"2.0.0.127.dnsbl.example.org.": {"listed first=2024-03-01"}},
+	}
+
+	res := NewRBL("dnsbl.example.org", true, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.Results[0].FirstSeen != nil {
+		t.Errorf("Expected no first-seen time by default, actual %v", res.Results[0].FirstSeen)
+	}
+
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithFirstSeenExtractor(FirstSeenField("first", time.DateOnly)))
+	res = rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if seen := res.Results[0].FirstSeen; seen == nil || !seen.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the extracted first-seen time, actual %v", seen)
+	}
+}
+
+func TestWithDeduplication(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		delay: time.Millisecond * 100,
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithDeduplication())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")); !res.IsListed() {
+				t.Errorf("Expected a listing, actual %+v", res.Results)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c := mock.hostQueryCount(); c != 1 {
+		t.Errorf("Expected a single shared query, actual %d", c)
+	}
+
+	// Once complete, the next lookup queries again.
+	rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if c := mock.hostQueryCount(); c != 2 {
+		t.Errorf("Expected a new query once the first completed, actual %d", c)
+	}
+}
+
+func TestWithDialerHonoursDeadline(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	dialed := make(chan bool, 1)
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		_, hasDeadline := ctx.Deadline()
+		select {
+		case dialed <- hasDeadline:
+		default:
+		}
+
+		// Simulate a slow connect that ignores the context.
+		<-release
+		return nil, &net.OpError{Op: "dial", Err: context.Canceled}
+	}
+
+	rbl := NewRBL("dnsbl.example.org", false, WithDialer(dial), WithTimeout(time.Millisecond*50))
+
+	start := time.Now()
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if elapsed := time.Since(start); elapsed > time.Second || !res.Results[0].Failed() {
+		t.Errorf("Expected the lookup to fail at the deadline, actual %+v after %s", res.Results, elapsed)
+	}
+
+	if !<-dialed {
+		t.Errorf("Expected the dial context to carry the query deadline")
+	}
+}
+
+func TestWithExplanationZone(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		txts: map[string][]string{
+			"2.0.0.127.dnsbl.example.org.":   {"Listed"},
+			"2.0.0.127.reasons.example.org.": {"reason=botnet", "since=2024-01-01"},
+		},
+	}
+
+	res := NewRBL("dnsbl.example.org", false, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if len(res.Results[0].Explanation) > 0 || mock.txtQueryCount() != 0 {
+		t.Errorf("Expected no explanation by default, actual %+v", res.Results[0])
+	}
+
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithExplanationZone("reasons.example.org"))
+	res = rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if r := res.Results[0]; !r.Listed || r.Text != "Listed" || !reflect.DeepEqual(r.Explanation, []string{"reason=botnet", "since=2024-01-01"}) {
+		t.Errorf("Expected the listing merged with its explanation, actual %+v", r)
+	}
+
+	// Clean IPs aren't explained.
+	before := mock.txtQueryCount()
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+	if c := mock.txtQueryCount(); c != before {
+		t.Errorf("Expected no explanation query for a clean IP, actual %d", c-before)
+	}
+}
+
+func TestLookupIPNormalizesTXT(t *testing.T) {
+	t.Parallel()
+	segments := []string{" Listed for spam;", "see https://dnsbl.example.org/lookup  "}
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		txts:  map[string][]string{"2.0.0.127.dnsbl.example.org.": segments},
+	}
+
+	res := NewRBL("dnsbl.example.org", true, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if r := res.Results[0]; r.Text != "Listed for spam; see https://dnsbl.example.org/lookup" || !reflect.DeepEqual(r.TextSegments, segments) {
+		t.Errorf("Expected the normalized text and raw segments, actual %+v", r)
+	}
+}
+
+func TestWithATimeoutAndTxtTimeout(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts:    map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		txts:     map[string][]string{"2.0.0.127.dnsbl.example.org.": {"Listed for spam"}},
+		delay:    time.Millisecond * 100,
+		txtDelay: time.Millisecond * 100,
+	}
+
+	// A TXT timeout longer than the general timeout lets the slow TXT query complete.
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithTimeout(time.Millisecond*150), WithTxtTimeout(time.Second))
+	if r := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")).Results[0]; !r.Listed || r.Text != "Listed for spam" || r.TxtTimeout {
+		t.Errorf("Expected the TXT record within its own timeout, actual %+v", r)
+	}
+
+	// A short TXT timeout cuts the enrichment short without affecting the listing.
+	rbl = NewRBL("dnsbl.example.org", true, WithResolver(mock), WithTxtTimeout(time.Millisecond*20))
+	if r := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")).Results[0]; !r.Listed || r.Error || !r.TxtTimeout {
+		t.Errorf("Expected the listing with the TXT timeout noted, actual %+v", r)
+	}
+
+	// A short A timeout fails the lookup, even though the caller allowed longer.
+	rbl = NewRBL("dnsbl.example.org", true, WithResolver(mock), WithATimeout(time.Millisecond*20), WithTxtTimeout(time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if r := rbl.LookupIP(ctx, net.ParseIP("127.0.0.2")).Results[0]; r.Listed || !r.Failed() {
+		t.Errorf("Expected the A query to time out, actual %+v", r)
+	}
+}
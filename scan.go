@@ -0,0 +1,225 @@
+package gorbl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ScanResult holds the outcome of a single line read by ScanReader.
+*/
+type ScanResult struct {
+	// Line is the line number of the input, starting at 1
+	Line int `json:"line"`
+	// Input is the IP or host read from the line
+	Input string `json:"input"`
+	// Results holds the results of the lookup; it is empty if the line was malformed
+	Results RBLResults `json:"results"`
+	// Err is set (wrapping ErrInvalidInput) if the line couldn't be looked up as an IP or host
+	Err error `json:"err"`
+}
+
+/*
+MultiScanResult holds the outcome of a single line read by MultiRBL.ScanReader.
+*/
+type MultiScanResult struct {
+	// Line is the line number of the input, starting at 1
+	Line int `json:"line"`
+	// Input is the IP or host read from the line
+	Input string `json:"input"`
+	// Results holds the results of the lookup, one per list; it is empty if the line was malformed
+	Results []RBLResults `json:"results"`
+	// Err is set (wrapping ErrInvalidInput) if the line couldn't be looked up as an IP or host
+	Err error `json:"err"`
+}
+
+/*
+ScanReader reads newline-delimited IPs and hosts from the supplied reader (such as a file or
+network connection) and looks each up using the supplied Lookuper. As with LookupBatch the
+lookups run sequentially unless the RBL has a concurrency limit (see WithMaxConcurrency), in
+which case up to that many run at once. Blank lines and anything following a '#' are ignored.
+
+One ScanResult is returned per IP or host, in the order they were read. Malformed lines
+(i.e. holding more than one value, or characters not valid in an IP or host) are reported
+on their ScanResult rather than stopping the scan. Percent-encoded and internationalized
+hosts are accepted, as by Lookup. An error is returned if the reader fails, along with the
+results of the lines read before it failed. Reading stops once the context is done (a read
+already in progress can't be interrupted), returning the context's error and the results
+of the lines already looked up.
+*/
+func ScanReader(ctx context.Context, r io.Reader, rbl Lookuper) ([]ScanResult, error) {
+	var ret []ScanResult
+
+	err := scanLines(ctx, r, scanWorkers(rbl), func(ctx context.Context, input string) []RBLResults {
+		if ip := net.ParseIP(input); ip != nil {
+			return []RBLResults{rbl.LookupIP(ctx, ip)}
+		}
+
+		return []RBLResults{rbl.Lookup(ctx, input)}
+	}, func(l *scannedLine) {
+		res := ScanResult{Line: l.line, Input: l.input, Err: l.err}
+		if len(l.results) > 0 {
+			res.Results = l.results[0]
+		}
+
+		ret = append(ret, res)
+	})
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Line < ret[j].Line
+	})
+
+	return ret, err
+}
+
+/*
+ScanReader reads newline-delimited IPs and hosts from the supplied reader and looks each up
+in every list, as the package level ScanReader does for a single list. Up to the lowest
+concurrency limit configured on the lists (see WithMaxConcurrency) run at once, or one at a
+time if none is.
+*/
+func (m *MultiRBL) ScanReader(ctx context.Context, r io.Reader) ([]MultiScanResult, error) {
+	var ret []MultiScanResult
+
+	err := m.ScanReaderFunc(ctx, r, func(res MultiScanResult) {
+		ret = append(ret, res)
+	})
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Line < ret[j].Line
+	})
+
+	return ret, err
+}
+
+/*
+ScanReaderFunc reads and looks up IPs and hosts as ScanReader does, but calls fn with the
+outcome of each line as soon as its lookup completes rather than once the input is exhausted,
+so input that never ends (i.e. a log being followed) is reported as it arrives. Outcomes are
+reported in completion order, and fn is never called concurrently. The returned error is the
+one ScanReader would return.
+*/
+func (m *MultiRBL) ScanReaderFunc(ctx context.Context, r io.Reader, fn func(MultiScanResult)) error {
+	return scanLines(ctx, r, scanWorkers(m.lists...), func(ctx context.Context, input string) []RBLResults {
+		if ip := net.ParseIP(input); ip != nil {
+			return m.LookupIP(ctx, ip)
+		}
+
+		return m.Lookup(ctx, input)
+	}, func(l *scannedLine) {
+		fn(MultiScanResult{Line: l.line, Input: l.input, Results: l.results, Err: l.err})
+	})
+}
+
+// scannedLine is an IP or host read by scanLines, along with the outcome of its lookup.
+type scannedLine struct {
+	line    int
+	input   string
+	results []RBLResults
+	err     error
+}
+
+/*
+scanLines reads the IPs and hosts from the supplied reader, as described by ScanReader,
+looking up each valid one using the supplied function (up to workers at once). Each line
+is passed to emit once it has been looked up (or found malformed); emit is never called concurrently.
+*/
+func scanLines(ctx context.Context, r io.Reader, workers int, lookup func(ctx context.Context, input string) []RBLResults, emit func(*scannedLine)) error {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, workers)
+	)
+
+	report := func(l *scannedLine) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		emit(l)
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	// Lookups start as lines are read, so slow readers (i.e. network connections) are scanned as they arrive.
+	for line := 1; ctx.Err() == nil && scanner.Scan(); line++ {
+		input := scanner.Text()
+		if idx := strings.Index(input, "#"); idx >= 0 {
+			input = input[:idx]
+		}
+
+		input = strings.TrimSpace(input)
+		if len(input) == 0 {
+			continue
+		}
+
+		l := &scannedLine{line: line, input: input, err: validateScanInput(input)}
+		if l.err != nil {
+			report(l)
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			// The line is left out, as it won't be looked up.
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			l.results = lookup(ctx, l.input)
+			report(l)
+		}()
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return scanner.Err()
+}
+
+/*
+scanWorkers returns the number of lookups a scan of the supplied lists runs at once: the lowest
+concurrency limit configured on them (see WithMaxConcurrency), or 1 if none is.
+*/
+func scanWorkers(lists ...Lookuper) int {
+	workers := 0
+
+	for _, l := range lists {
+		if r, ok := l.(*RBL); ok && r.maxConcurrency > 0 && (workers == 0 || r.maxConcurrency < workers) {
+			workers = r.maxConcurrency
+		}
+	}
+
+	return max(workers, 1)
+}
+
+// validateScanInput returns an error wrapping ErrInvalidInput if the supplied input can't be an IP or host.
+func validateScanInput(input string) error {
+	for _, c := range input {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == '_', c == ':', c == '%':
+		case c >= utf8.RuneSelf && !unicode.IsSpace(c):
+			// Non-ASCII hosts are converted (and validated) when looked up.
+		default:
+			return fmt.Errorf("%w: %q is not an IP or host", ErrInvalidInput, input)
+		}
+	}
+
+	return nil
+}
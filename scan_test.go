@@ -0,0 +1,191 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestScanReader(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		ips:   map[string][]net.IPAddr{"mail.example.com": {{IP: net.ParseIP("127.0.0.2")}}},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	input := "# scanned hosts\n127.0.0.2\n\n192.0.2.1 # clean\nnot a host\nmail.example.com\nbad;host\n"
+	results, err := ScanReader(context.Background(), strings.NewReader(input), rbl)
+	if err != nil {
+		t.Fatalf("Expected no error, actual %v", err)
+	}
+
+	expected := []struct {
+		line    int
+		input   string
+		listed  bool
+		invalid bool
+	}{
+		{line: 2, input: "127.0.0.2", listed: true},
+		{line: 4, input: "192.0.2.1"},
+		{line: 5, input: "not a host", invalid: true},
+		{line: 6, input: "mail.example.com", listed: true},
+		{line: 7, input: "bad;host", invalid: true},
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, actual %+v", len(expected), results)
+	}
+
+	for i, e := range expected {
+		res := results[i]
+		if res.Line != e.line || res.Input != e.input {
+			t.Errorf("Expected line %d (%s), actual line %d (%s)", e.line, e.input, res.Line, res.Input)
+		}
+
+		if res.Results.IsListed() != e.listed {
+			t.Errorf("Expected %s listed %t, actual %+v", e.input, e.listed, res.Results)
+		}
+
+		if errors.Is(res.Err, ErrInvalidInput) != e.invalid {
+			t.Errorf("Expected %s invalid %t, actual %v", e.input, e.invalid, res.Err)
+		}
+	}
+}
+
+// failingReader returns its data followed by an error.
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if len(f.data) == 0 {
+		return 0, f.err
+	}
+
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+	return n, nil
+}
+
+func TestScanReaderError(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	readErr := errors.New("connection reset")
+	results, err := ScanReader(context.Background(), &failingReader{data: "127.0.0.2\n", err: readErr}, rbl)
+
+	if !errors.Is(err, readErr) {
+		t.Errorf("Expected the read error, actual %v", err)
+	}
+
+	if len(results) != 1 || !results[0].Results.IsListed() {
+		t.Errorf("Expected the lines read before the error to be looked up, actual %+v", results)
+	}
+}
+
+func TestScanReaderPercentEncoded(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		ips:   map[string][]net.IPAddr{"mail.example.com": {{IP: net.ParseIP("127.0.0.2")}}},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	results, err := ScanReader(context.Background(), strings.NewReader("mail%2Eexample.com\n"), rbl)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Expected a single result, actual %+v (%v)", results, err)
+	}
+
+	direct := rbl.Lookup(context.Background(), "mail%2Eexample.com")
+	if res := results[0]; res.Err != nil || !res.Results.IsListed() || !direct.IsListed() {
+		t.Errorf("Expected the percent-encoded host to be looked up as by Lookup, actual %+v", res)
+	}
+}
+
+// cancellingReader serves lines forever, cancelling its context once it has served a few.
+type cancellingReader struct {
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (c *cancellingReader) Read(p []byte) (int, error) {
+	c.reads++
+	if c.reads == 3 {
+		c.cancel()
+	}
+
+	return copy(p, "192.0.2.1\n"), nil
+}
+
+func TestScanReaderCancelled(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(&mockResolver{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := &cancellingReader{cancel: cancel}
+
+	results, err := ScanReader(ctx, reader, rbl)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context's error, actual %v", err)
+	}
+
+	if reader.reads > 3 || len(results) > 3 {
+		t.Errorf("Expected reading to stop once cancelled, actual %d reads and %d results", reader.reads, len(results))
+	}
+}
+
+func TestMultiRBLScanReader(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"1.2.0.192.b.example.org.": {"127.0.0.2"}}}
+	m := NewMultiRBL([]Lookuper{
+		NewRBL("a.example.org", false, WithResolver(mock)),
+		NewRBL("b.example.org", false, WithResolver(mock)),
+	})
+
+	results, err := m.ScanReader(context.Background(), strings.NewReader("192.0.2.1\nbad host\n"))
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Expected 2 results, actual %+v (%v)", results, err)
+	}
+
+	if res := results[0]; len(res.Results) != 2 || res.Results[0].IsListed() || !res.Results[1].IsListed() {
+		t.Errorf("Expected results from every list, actual %+v", res.Results)
+	}
+
+	if res := results[1]; res.Line != 2 || !errors.Is(res.Err, ErrInvalidInput) || len(res.Results) != 0 {
+		t.Errorf("Expected the malformed line to be reported, actual %+v", res)
+	}
+}
+
+func TestMultiRBLScanReaderConcurrency(t *testing.T) {
+	t.Parallel()
+	input := strings.Repeat("192.0.2.1\n", 8)
+
+	for name, opts := range map[string][][]Option{
+		"no limit":     {nil, nil},
+		"lowest limit": {{WithMaxConcurrency(1)}, {WithMaxConcurrency(3)}},
+	} {
+		mock := &mockResolver{delay: time.Millisecond * 10}
+		m := NewMultiRBL([]Lookuper{
+			NewRBL("a.example.org", false, append(opts[0], WithResolver(mock))...),
+			NewRBL("b.example.org", false, append(opts[1], WithResolver(mock))...),
+		})
+
+		if _, err := m.ScanReader(context.Background(), strings.NewReader(input)); err != nil {
+			t.Fatalf("Expected no error, actual %v", err)
+		}
+
+		mock.mu.Lock()
+		// A single line is looked up at once, querying both lists.
+		if mock.maxInFlight != 2 {
+			t.Errorf("Expected 2 queries in flight at most with %s, actual %d", name, mock.maxInFlight)
+		}
+		mock.mu.Unlock()
+	}
+}
@@ -0,0 +1,250 @@
+package gorbl
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/*
+SchemaVersion is the version of the interchange format written by MarshalResults. It is
+increased whenever a change would break consumers of persisted results; fields may be
+added without increasing it.
+*/
+const SchemaVersion = 1
+
+/*
+schemaDocument is the versioned interchange format for results. Its field names are part of
+the format, decoupled from the Go types: renaming a Go field never changes the wire format.
+*/
+type schemaDocument struct {
+	Version int             `json:"schema_version"`
+	Results []schemaResults `json:"results"`
+}
+
+// schemaResults is the interchange form of an RBLResults.
+type schemaResults struct {
+	List       string         `json:"list"`
+	Host       string         `json:"host"`
+	HostASCII  string         `json:"host_ascii,omitempty"`
+	Whitelist  bool           `json:"whitelist,omitempty"`
+	Category   string         `json:"category,omitempty"`
+	Weight     float64        `json:"weight,omitempty"`
+	Incomplete bool           `json:"incomplete,omitempty"`
+	Results    []schemaResult `json:"results"`
+}
+
+// schemaResult is the interchange form of a Result.
+type schemaResult struct {
+	Address            string             `json:"address"`
+	MappedFrom         string             `json:"mapped_from,omitempty"`
+	Zone               string             `json:"zone,omitempty"`
+	QueriedName        string             `json:"queried_name,omitempty"`
+	ReportedBy         []string           `json:"reported_by,omitempty"`
+	DuplicateOf        string             `json:"duplicate_of,omitempty"`
+	Listed             bool               `json:"listed"`
+	ListedAddress      string             `json:"listed_address,omitempty"`
+	SubLists           []string           `json:"sub_lists,omitempty"`
+	Score              *float64           `json:"score,omitempty"`
+	Reason             string             `json:"reason,omitempty"`
+	Explanation        []string           `json:"explanation,omitempty"`
+	Text               string             `json:"text,omitempty"`
+	TextSegments       []string           `json:"text_segments,omitempty"`
+	TxtQueried         bool               `json:"txt_queried,omitempty"`
+	TxtTimeout         bool               `json:"txt_timeout,omitempty"`
+	ParsedText         map[string]string  `json:"parsed_text,omitempty"`
+	FirstSeen          *time.Time         `json:"first_seen,omitempty"`
+	RemovalURLTemplate string             `json:"removal_url_template,omitempty"`
+	Error              *string            `json:"error,omitempty"`
+	ErrorNotFound      bool               `json:"error_not_found,omitempty"`
+	ErrorKind          string             `json:"error_kind,omitempty"`
+	ErrorCode          string             `json:"error_code,omitempty"`
+	FetchedAt          time.Time          `json:"fetched_at"`
+	AnsweredBy         string             `json:"answered_by,omitempty"`
+	Overridden         bool               `json:"overridden,omitempty"`
+	Skipped            bool               `json:"skipped,omitempty"`
+	FromCache          bool               `json:"from_cache,omitempty"`
+	Meta               *schemaMeta        `json:"meta,omitempty"`
+	Diagnostics        *schemaDiagnostics `json:"diagnostics,omitempty"`
+}
+
+// schemaMeta is the interchange form of a ResponseMeta.
+type schemaMeta struct {
+	RCode         int  `json:"rcode"`
+	Answers       int  `json:"answers"`
+	Authoritative bool `json:"authoritative"`
+}
+
+// schemaDiagnostics is the interchange form of a Diagnostics.
+type schemaDiagnostics struct {
+	QuerySize     int  `json:"query_size"`
+	ResponseSize  int  `json:"response_size"`
+	TCP           bool `json:"tcp"`
+	TruncatedSize int  `json:"truncated_size"`
+}
+
+/*
+MarshalResults encodes the supplied results in the versioned interchange format (see
+SchemaVersion), for persisting or exchanging results between pipelines. Unlike the
+encoding provided by the struct tags, the format is stable as the Go types evolve.
+Errors are encoded as their message, as with Result.MarshalJSON.
+*/
+func MarshalResults(results []RBLResults) ([]byte, error) {
+	doc := schemaDocument{
+		Version: SchemaVersion,
+		Results: make([]schemaResults, 0, len(results)),
+	}
+
+	for _, ret := range results {
+		sr := schemaResults{
+			List:       ret.List,
+			Host:       ret.Host,
+			HostASCII:  ret.HostASCII,
+			Whitelist:  ret.Whitelist,
+			Category:   string(ret.Category),
+			Weight:     ret.Weight,
+			Incomplete: ret.Incomplete,
+			Results:    make([]schemaResult, 0, len(ret.Results)),
+		}
+
+		for _, res := range ret.Results {
+			sr.Results = append(sr.Results, toSchemaResult(res))
+		}
+
+		doc.Results = append(doc.Results, sr)
+	}
+
+	return json.Marshal(doc)
+}
+
+/*
+UnmarshalResults decodes results encoded by MarshalResults. An error wrapping
+ErrInvalidInput is returned for documents written with a newer schema version. Errors are
+restored as by Result.UnmarshalJSON.
+*/
+func UnmarshalResults(data []byte) ([]RBLResults, error) {
+	var doc schemaDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Version < 1 || doc.Version > SchemaVersion {
+		return nil, fmt.Errorf("%w: unsupported schema version %d", ErrInvalidInput, doc.Version)
+	}
+
+	results := make([]RBLResults, 0, len(doc.Results))
+	for _, sr := range doc.Results {
+		ret := RBLResults{
+			List:       sr.List,
+			Host:       sr.Host,
+			HostASCII:  sr.HostASCII,
+			Whitelist:  sr.Whitelist,
+			Category:   Category(sr.Category),
+			Weight:     sr.Weight,
+			Incomplete: sr.Incomplete,
+			Results:    make([]Result, 0, len(sr.Results)),
+		}
+
+		for _, res := range sr.Results {
+			ret.Results = append(ret.Results, res.result())
+		}
+
+		results = append(results, ret)
+	}
+
+	return results, nil
+}
+
+// toSchemaResult converts the supplied result into its interchange form.
+func toSchemaResult(res Result) schemaResult {
+	sr := schemaResult{
+		Address:            res.Address,
+		MappedFrom:         res.MappedFrom,
+		Zone:               res.Zone,
+		QueriedName:        res.QueriedName,
+		ReportedBy:         res.ReportedBy,
+		DuplicateOf:        res.DuplicateOf,
+		Listed:             res.Listed,
+		ListedAddress:      res.ListedAddress,
+		SubLists:           res.SubLists,
+		Score:              res.ScoreValue,
+		Reason:             res.Reason,
+		Explanation:        res.Explanation,
+		Text:               res.Text,
+		TextSegments:       res.TextSegments,
+		TxtQueried:         res.TxtQueried,
+		TxtTimeout:         res.TxtTimeout,
+		ParsedText:         res.ParsedText,
+		FirstSeen:          res.FirstSeen,
+		RemovalURLTemplate: res.RemovalURLTemplate,
+		FetchedAt:          res.FetchedAt,
+		AnsweredBy:         res.AnsweredBy,
+		Overridden:         res.Overridden,
+		Skipped:            res.Skipped,
+		FromCache:          res.FromCache,
+	}
+
+	if res.ErrorType != nil {
+		msg := res.ErrorType.Error()
+		sr.Error = &msg
+		sr.ErrorNotFound = isNotFound(res.ErrorType)
+		sr.ErrorKind, sr.ErrorCode = errorKind(res.ErrorType)
+	}
+
+	if res.Meta != nil {
+		sr.Meta = &schemaMeta{RCode: int(res.Meta.RCode), Answers: res.Meta.Answers, Authoritative: res.Meta.Authoritative}
+	}
+
+	if d := res.Diagnostics; d != nil {
+		sr.Diagnostics = &schemaDiagnostics{QuerySize: d.QuerySize, ResponseSize: d.ResponseSize, TCP: d.TCP, TruncatedSize: d.TruncatedSize}
+	}
+
+	return sr
+}
+
+// result converts the interchange form back into a Result.
+func (sr schemaResult) result() Result {
+	res := Result{
+		Address:            sr.Address,
+		MappedFrom:         sr.MappedFrom,
+		Zone:               sr.Zone,
+		QueriedName:        sr.QueriedName,
+		ReportedBy:         sr.ReportedBy,
+		DuplicateOf:        sr.DuplicateOf,
+		Listed:             sr.Listed,
+		ListedAddress:      sr.ListedAddress,
+		SubLists:           sr.SubLists,
+		ScoreValue:         sr.Score,
+		Reason:             sr.Reason,
+		Explanation:        sr.Explanation,
+		Text:               sr.Text,
+		TextSegments:       sr.TextSegments,
+		TxtQueried:         sr.TxtQueried,
+		TxtTimeout:         sr.TxtTimeout,
+		ParsedText:         sr.ParsedText,
+		FirstSeen:          sr.FirstSeen,
+		RemovalURLTemplate: sr.RemovalURLTemplate,
+		FetchedAt:          sr.FetchedAt,
+		AnsweredBy:         sr.AnsweredBy,
+		Overridden:         sr.Overridden,
+		Skipped:            sr.Skipped,
+		FromCache:          sr.FromCache,
+	}
+
+	if sr.Error != nil {
+		res.Error = true
+		res.ErrorType = restoreError(*sr.Error, sr.ErrorNotFound, sr.ErrorKind, sr.ErrorCode)
+	}
+
+	if sr.Meta != nil {
+		res.Meta = &ResponseMeta{RCode: dnsmessage.RCode(sr.Meta.RCode), Answers: sr.Meta.Answers, Authoritative: sr.Meta.Authoritative}
+	}
+
+	if d := sr.Diagnostics; d != nil {
+		res.Diagnostics = &Diagnostics{QuerySize: d.QuerySize, ResponseSize: d.ResponseSize, TCP: d.TCP, TruncatedSize: d.TruncatedSize}
+	}
+
+	return res
+}
@@ -0,0 +1,140 @@
+package gorbl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestMarshalResultsRoundTrip(t *testing.T) {
+	t.Parallel()
+	score := 5.0
+	seen := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	original := []RBLResults{{
+		List:     "dnsbl.example.org",
+		Host:     "mail.example.com",
+		Category: CategorySpam,
+		Results: []Result{
+			{
+				Address:       "192.0.2.1",
+				Zone:          "dnsbl.example.org",
+				QueriedName:   "1.2.0.192.dnsbl.example.org.",
+				DuplicateOf:   "dnsbl.example.net",
+				Listed:        true,
+				ListedAddress: "127.0.0.2",
+				SubLists:      []string{"SBL"},
+				ScoreValue:    &score,
+				Text:          "trust=2",
+				TextSegments:  []string{"trust=2"},
+				ParsedText:    map[string]string{"trust": "2"},
+				FirstSeen:     &seen,
+				TxtQueried:    true,
+				FromCache:     true,
+				FetchedAt:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Meta:          &ResponseMeta{RCode: dnsmessage.RCodeSuccess, Answers: 1, Authoritative: true},
+				Diagnostics:   &Diagnostics{QuerySize: 45, ResponseSize: 1400, TCP: true, TruncatedSize: 512},
+			},
+			{
+				Address:   "192.0.2.2",
+				Error:     true,
+				ErrorType: &net.DNSError{Err: "no such host", Name: "2.2.0.192.dnsbl.example.org.", IsNotFound: true},
+			},
+			{
+				Error:     true,
+				ErrorType: ErrEmptyHost,
+			},
+		},
+	}}
+
+	data, err := MarshalResults(original)
+	if err != nil {
+		t.Fatalf("Unable to marshal results: %v", err)
+	}
+
+	decoded, err := UnmarshalResults(data)
+	if err != nil {
+		t.Fatalf("Unable to unmarshal results: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded[0].Results[0], original[0].Results[0]) {
+		t.Errorf("Expected %+v, actual %+v", original[0].Results[0], decoded[0].Results[0])
+	}
+
+	if r := decoded[0].Results[1]; r.Failed() || r.ErrorType.Error() != original[0].Results[1].ErrorType.Error() {
+		t.Errorf("Expected the NXDOMAIN answer to survive, actual %+v", r)
+	}
+
+	if r := decoded[0].Results[2]; r.ErrorType != ErrEmptyHost {
+		t.Errorf("Expected the sentinel error to be restored, actual %+v", r)
+	}
+
+	if decoded[0].List != "dnsbl.example.org" || decoded[0].Category != CategorySpam {
+		t.Errorf("Expected the list details to survive, actual %+v", decoded[0])
+	}
+}
+
+func TestMarshalResultsSchema(t *testing.T) {
+	t.Parallel()
+	data, err := MarshalResults([]RBLResults{{List: "dnsbl.example.org", Host: "192.0.2.1", Results: []Result{{Address: "192.0.2.1", ScoreValue: new(float64)}}}})
+	if err != nil {
+		t.Fatalf("Unable to marshal results: %v", err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unable to unmarshal document: %v", err)
+	}
+
+	if v := doc["schema_version"]; v != float64(SchemaVersion) {
+		t.Errorf("Expected schema version %d, actual %v", SchemaVersion, v)
+	}
+
+	// The wire names are fixed by the schema rather than the Go field names.
+	if !strings.Contains(string(data), `"score":0`) || strings.Contains(string(data), "ScoreValue") || strings.Contains(string(data), "score_value") {
+		t.Errorf("Expected the schema's field names, actual %s", data)
+	}
+
+	if _, err := UnmarshalResults([]byte(`{"schema_version":99,"results":[]}`)); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a newer schema, actual %v", err)
+	}
+}
+
+func TestMarshalResultsErrorKinds(t *testing.T) {
+	t.Parallel()
+	qErr, _ := ParseQueryError("127.255.255.254")
+	original := []RBLResults{{List: "dnsbl.example.org", Results: []Result{
+		{Address: "192.0.2.1", Error: true, ErrorType: fmt.Errorf("%w: %q is not an IPv4 address", ErrInvalidInput, "192.0.2")},
+		{Address: "192.0.2.2", Error: true, ErrorType: fmt.Errorf("%w: 192.0.2.2", ErrUnexpectedAnswer)},
+		{Address: "192.0.2.3", Error: true, ErrorType: qErr},
+	}}}
+
+	data, err := MarshalResults(original)
+	if err != nil {
+		t.Fatalf("Unable to marshal results: %v", err)
+	}
+
+	decoded, err := UnmarshalResults(data)
+	if err != nil {
+		t.Fatalf("Unable to unmarshal results: %v", err)
+	}
+
+	if err := decoded[0].Results[0].ErrorType; !errors.Is(err, ErrInvalidInput) || err.Error() != original[0].Results[0].ErrorType.Error() {
+		t.Errorf("Expected the wrapped ErrInvalidInput to be restored, actual %v", err)
+	}
+
+	if err := decoded[0].Results[1].ErrorType; !errors.Is(err, ErrUnexpectedAnswer) {
+		t.Errorf("Expected the wrapped ErrUnexpectedAnswer to be restored, actual %v", err)
+	}
+
+	var restored *QueryError
+	if err := decoded[0].Results[2].ErrorType; !errors.As(err, &restored) || restored.Code != qErr.Code {
+		t.Errorf("Expected the query error to be restored, actual %v", err)
+	}
+}
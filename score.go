@@ -0,0 +1,21 @@
+package gorbl
+
+/*
+ScoreExtractor interprets the address returned for a listing as a numeric score, for lists
+encoding a reputation in their return codes. The second return value is false if the code
+doesn't carry a score.
+*/
+type ScoreExtractor func(code string) (float64, bool)
+
+/*
+LastOctetScore is a ScoreExtractor using the last octet of a 127.0.0.0/8 return code as the
+score (127.0.0.5 scores 5).
+*/
+func LastOctetScore(code string) (float64, bool) {
+	_, octets, err := ParseReturnCode(code)
+	if err != nil || octets[0] != 127 {
+		return 0, false
+	}
+
+	return float64(octets[3]), true
+}
@@ -0,0 +1,39 @@
+package gorbl
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestLastOctetScore(t *testing.T) {
+	t.Parallel()
+	if score, ok := LastOctetScore("127.0.0.5"); !ok || score != 5 {
+		t.Errorf("Expected 5, actual %v (%t)", score, ok)
+	}
+
+	for _, code := range []string{"192.0.2.1", "garbage", "::1"} {
+		if _, ok := LastOctetScore(code); ok {
+			t.Errorf("Expected no score for %s", code)
+		}
+	}
+}
+
+func TestLookupIPScore(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.12"}},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithScoreExtractor(LastOctetScore))
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.Results[0].ScoreValue == nil || *res.Results[0].ScoreValue != 12 {
+		t.Errorf("Expected a score of 12, actual %+v", res.Results[0])
+	}
+
+	res = NewRBL("dnsbl.example.org", false, WithResolver(mock)).LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	if res.Results[0].ScoreValue != nil {
+		t.Errorf("Expected no score without an extractor, actual %v", *res.Results[0].ScoreValue)
+	}
+}
@@ -0,0 +1,63 @@
+package gorbl
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+/*
+WriteSyslog writes the supplied results to w as structured key=value lines, one per result,
+suitable for ingestion by syslog and SIEM pipelines:
+
+	list=zen.spamhaus.org ip=192.0.2.1 verdict=listed code=127.0.0.2 text="Listed for spam"
+
+The verdict is one of listed, clean or error. Values containing spaces, quotes or '=' are
+quoted; code and text are empty unless the result is a listing.
+*/
+func WriteSyslog(w io.Writer, results []RBLResults) error {
+	return WriteSyslogMasked(w, results, nil)
+}
+
+/*
+WriteSyslogMasked writes the supplied results as WriteSyslog does, masking each IP written
+using the supplied function (such as MaskIP) for deployments that must not log full IPs.
+Addresses that aren't IPs are written unchanged; IPs aren't masked if mask is nil.
+*/
+func WriteSyslogMasked(w io.Writer, results []RBLResults, mask func(net.IP) net.IP) error {
+	for _, ret := range results {
+		for _, res := range ret.Results {
+			address := res.Address
+			if ip := net.ParseIP(address); ip != nil && mask != nil {
+				address = mask(ip).String()
+			}
+
+			verdict := "clean"
+			switch {
+			case res.Listed:
+				verdict = "listed"
+			case res.Failed():
+				verdict = "error"
+			}
+
+			_, err := fmt.Fprintf(w, "list=%s ip=%s verdict=%s code=%s text=%s\n",
+				syslogValue(ret.List), syslogValue(address), verdict, syslogValue(res.ListedAddress), syslogValue(res.Text))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// syslogValue returns the supplied value, quoted if it would otherwise break the key=value format.
+func syslogValue(value string) string {
+	if len(value) == 0 || !strings.ContainsAny(value, " \t\"=\\\n") {
+		return value
+	}
+
+	return strconv.Quote(value)
+}
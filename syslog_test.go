@@ -0,0 +1,58 @@
+package gorbl
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestWriteSyslog(t *testing.T) {
+	t.Parallel()
+	results := []RBLResults{
+		{List: "dnsbl.example.org", Results: []Result{
+			{Address: "192.0.2.1", Listed: true, ListedAddress: "127.0.0.2", Text: `Listed for "spam"`},
+		}},
+		{List: "dnsbl.example.net", Results: []Result{
+			{Address: "192.0.2.1", Error: true, ErrorType: &net.DNSError{Err: "no such host", IsNotFound: true}},
+			{Address: "192.0.2.1", Error: true, ErrorType: errors.New("timeout")},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSyslog(&buf, results); err != nil {
+		t.Fatalf("Expected no error, actual %v", err)
+	}
+
+	expected := `list=dnsbl.example.org ip=192.0.2.1 verdict=listed code=127.0.0.2 text="Listed for \"spam\""
+list=dnsbl.example.net ip=192.0.2.1 verdict=clean code= text=
+list=dnsbl.example.net ip=192.0.2.1 verdict=error code= text=
+`
+	if buf.String() != expected {
+		t.Errorf("Expected %q, actual %q", expected, buf.String())
+	}
+}
+
+func TestWriteSyslogMasked(t *testing.T) {
+	t.Parallel()
+	results := []RBLResults{
+		{List: "dnsbl.example.org", Results: []Result{
+			{Address: "192.0.2.1", Listed: true, ListedAddress: "127.0.0.2"},
+			{Address: "2001:db8:1:2::1"},
+			{Address: "example.com"},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSyslogMasked(&buf, results, MaskIP); err != nil {
+		t.Fatalf("Expected no error, actual %v", err)
+	}
+
+	expected := `list=dnsbl.example.org ip=192.0.2.0 verdict=listed code=127.0.0.2 text=
+list=dnsbl.example.org ip=2001:db8:1:: verdict=clean code= text=
+list=dnsbl.example.org ip=example.com verdict=clean code= text=
+`
+	if buf.String() != expected {
+		t.Errorf("Expected %q, actual %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,38 @@
+package gorbl
+
+import "context"
+
+/*
+Tracer is invoked around each DNS query an RBL issues, allowing callers to bridge lookups
+into a tracing system (i.e. wrapping each query in an OpenTelemetry span) without gorbl
+depending on one. StartQuery is called before the query with the RBL's hostname, the query
+name (with the IP masked if WithLogMasking is set) and the record type ("A" or "TXT"); the
+returned context is used for the query.
+*/
+type Tracer interface {
+	StartQuery(ctx context.Context, list string, name string, qtype string) (context.Context, Span)
+}
+
+/*
+Span is a single traced query. End is called once the query completes, reporting whether
+any answer encoded a listing and the error the query failed with, if any. NXDOMAIN answers
+are not reported as errors.
+*/
+type Span interface {
+	End(listed bool, err error)
+}
+
+// startQuery starts a span for the supplied query using the configured tracer, returning a no-op end if none is set.
+func (r *RBL) startQuery(ctx context.Context, address string, name string, qtype string) (context.Context, func(listed bool, err error)) {
+	if r.tracer == nil {
+		return ctx, func(bool, error) {}
+	}
+
+	ctx, span := r.tracer.StartQuery(ctx, r.hostname, r.maskName(address, name), qtype)
+	return ctx, func(listed bool, err error) {
+		if isNotFound(err) {
+			err = nil
+		}
+		span.End(listed, err)
+	}
+}
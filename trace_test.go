@@ -0,0 +1,69 @@
+package gorbl
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// recordedSpan is a query traced by a mockTracer.
+type recordedSpan struct {
+	list   string
+	name   string
+	qtype  string
+	listed bool
+	err    error
+}
+
+// mockTracer records every span it starts.
+type mockTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (m *mockTracer) StartQuery(ctx context.Context, list string, name string, qtype string) (context.Context, Span) {
+	span := &recordedSpan{list: list, name: name, qtype: qtype}
+
+	m.mu.Lock()
+	m.spans = append(m.spans, span)
+	m.mu.Unlock()
+
+	return ctx, span
+}
+
+func (s *recordedSpan) End(listed bool, err error) {
+	s.listed = listed
+	s.err = err
+}
+
+func TestWithTracer(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+		txts:  map[string][]string{"2.0.0.127.dnsbl.example.org.": {"Listed for spam"}},
+	}
+	tracer := &mockTracer{}
+	rbl := NewRBL("dnsbl.example.org", true, WithResolver(mock), WithTracer(tracer))
+
+	rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2"))
+	rbl.LookupIP(context.Background(), net.ParseIP("192.0.2.1"))
+
+	if len(tracer.spans) != 3 {
+		t.Fatalf("Expected 3 spans, actual %d", len(tracer.spans))
+	}
+
+	if s := tracer.spans[0]; s.list != "dnsbl.example.org" || s.name != "2.0.0.127.dnsbl.example.org." || s.qtype != "A" || !s.listed || s.err != nil {
+		t.Errorf("Expected a listed A span, actual %+v", s)
+	}
+
+	if s := tracer.spans[1]; s.qtype != "TXT" || s.err != nil {
+		t.Errorf("Expected a TXT span, actual %+v", s)
+	}
+
+	// NXDOMAIN isn't reported as an error.
+	if s := tracer.spans[2]; s.name != "1.2.0.192.dnsbl.example.org." || s.listed || s.err != nil {
+		t.Errorf("Expected a clean A span, actual %+v", s)
+	}
+}
@@ -0,0 +1,36 @@
+package gorbl
+
+import "net"
+
+var (
+	// sixToFourPrefix is the 6to4 prefix (2002::/16, RFC 3056)
+	sixToFourPrefix = net.IPNet{IP: net.ParseIP("2002::"), Mask: net.CIDRMask(16, 128)}
+	// teredoPrefix is the Teredo prefix (2001::/32, RFC 4380)
+	teredoPrefix = net.IPNet{IP: net.ParseIP("2001::"), Mask: net.CIDRMask(32, 128)}
+	// nat64Prefix is the NAT64 well-known prefix (64:ff9b::/96, RFC 6052)
+	nat64Prefix = net.IPNet{IP: net.ParseIP("64:ff9b::"), Mask: net.CIDRMask(96, 128)}
+)
+
+/*
+EmbeddedIPv4 extracts the IPv4 address embedded in an IPv6 transition address (6to4,
+Teredo or the NAT64 well-known prefix). The second return value is false if the supplied
+address isn't a recognized transition address.
+*/
+func EmbeddedIPv4(ip net.IP) (net.IP, bool) {
+	ip16 := ip.To16()
+	if ip16 == nil || ip.To4() != nil {
+		return nil, false
+	}
+
+	switch {
+	case sixToFourPrefix.Contains(ip16):
+		return net.IPv4(ip16[2], ip16[3], ip16[4], ip16[5]), true
+	case teredoPrefix.Contains(ip16):
+		// Teredo stores the client address obfuscated (bitwise inverted) in the last 32 bits.
+		return net.IPv4(^ip16[12], ^ip16[13], ^ip16[14], ^ip16[15]), true
+	case nat64Prefix.Contains(ip16):
+		return net.IPv4(ip16[12], ip16[13], ip16[14], ip16[15]), true
+	}
+
+	return nil, false
+}
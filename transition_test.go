@@ -0,0 +1,67 @@
+package gorbl
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestEmbeddedIPv4(t *testing.T) {
+	t.Parallel()
+	cases := map[string]string{
+		"2002:c000:0201::1":                    "192.0.2.1",
+		"2001:0:4136:e378:8000:63bf:3fff:fdd2": "192.0.2.45",
+		"64:ff9b::c000:0201":                   "192.0.2.1",
+	}
+
+	for addr, expected := range cases {
+		v4, ok := EmbeddedIPv4(net.ParseIP(addr))
+		if !ok || v4.String() != expected {
+			t.Errorf("Expected %s for %s, actual %s (%t)", expected, addr, v4, ok)
+		}
+	}
+
+	for _, addr := range []string{"2001:db8::1", "192.0.2.1", "::1"} {
+		if _, ok := EmbeddedIPv4(net.ParseIP(addr)); ok {
+			t.Errorf("Expected %s to not be a transition address", addr)
+		}
+	}
+}
+
+func TestLookupIPTransitionMapping(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"1.2.0.192.dnsbl.example.org.": {"127.0.0.2"}},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithTransitionMapping())
+
+	res := rbl.LookupIP(context.Background(), net.ParseIP("2002:c000:0201::1"))
+
+	if len(res.Results) != 1 || !res.Results[0].Listed {
+		t.Fatalf("Expected the embedded IPv4 to be listed, actual %+v", res.Results)
+	}
+
+	if res.Results[0].Address != "192.0.2.1" || res.Results[0].MappedFrom != "2002:c000:201::1" {
+		t.Errorf("Expected the mapping to be recorded, actual %+v", res.Results[0])
+	}
+}
+
+func TestLookupHostWithIPsTransitionMapping(t *testing.T) {
+	t.Parallel()
+	ips := []net.IP{net.ParseIP("64:ff9b::c000:0201"), net.ParseIP("2001:db8::1")}
+	mock := &mockResolver{ips: map[string][]net.IPAddr{"mail.example.com": {{IP: ips[0]}, {IP: ips[1]}}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithTransitionMapping())
+
+	res := rbl.LookupHostWithIPs(context.Background(), "mail.example.com", ips)
+
+	if len(res.Results) != 2 || res.Results[0].Address != "192.0.2.1" || res.Results[1].Address != "2001:db8::1" {
+		t.Errorf("Expected the NAT64 address to be mapped and the supplied IPv6 address searched, actual %+v", res.Results)
+	}
+
+	// Resolved hosts are only searched by their IPv4 (and mappable) addresses.
+	res = rbl.Lookup(context.Background(), "mail.example.com")
+	if len(res.Results) != 1 || res.Results[0].Address != "192.0.2.1" {
+		t.Errorf("Expected only the NAT64 address to be searched, actual %+v", res.Results)
+	}
+}
@@ -0,0 +1,69 @@
+package gorbl
+
+import (
+	"strings"
+	"time"
+)
+
+/*
+TxtParser extracts structured fields out of the TXT record returned for a listing.
+The parsed fields are stored on Result.ParsedText.
+*/
+type TxtParser func(txt string) map[string]string
+
+/*
+FirstSeenExtractor extracts the time a listing was first seen out of its TXT record,
+returning false if the record doesn't carry one. The time is stored on Result.FirstSeen.
+*/
+type FirstSeenExtractor func(txt string) (time.Time, bool)
+
+/*
+NormalizeTXT joins the supplied TXT records into a single line of display text: records are
+joined with a single space, and leading, trailing and repeated whitespace is removed.
+*/
+func NormalizeTXT(txt []string) string {
+	return strings.Join(strings.Fields(strings.Join(txt, " ")), " ")
+}
+
+/*
+ParseKeyValueTXT is a TxtParser for TXT records made up of whitespace or semicolon
+separated key=value pairs (i.e. "trust=2; category=isp"). Tokens without an '=' are ignored.
+*/
+func ParseKeyValueTXT(txt string) map[string]string {
+	fields := map[string]string{}
+
+	tokens := strings.FieldsFunc(txt, func(c rune) bool {
+		return c == ';' || c == ' ' || c == '\t'
+	})
+
+	for _, token := range tokens {
+		kv := strings.SplitN(token, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			continue
+		}
+
+		fields[kv[0]] = kv[1]
+	}
+
+	return fields
+}
+
+/*
+FirstSeenField returns a FirstSeenExtractor reading the supplied key=value field of the TXT
+record (see ParseKeyValueTXT), parsed using the supplied time layout (i.e. time.RFC3339).
+*/
+func FirstSeenField(key string, layout string) FirstSeenExtractor {
+	return func(txt string) (time.Time, bool) {
+		value, ok := ParseKeyValueTXT(txt)[key]
+		if !ok {
+			return time.Time{}, false
+		}
+
+		seen, err := time.Parse(layout, value)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		return seen, true
+	}
+}
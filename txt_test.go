@@ -0,0 +1,61 @@
+package gorbl
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseKeyValueTXT(t *testing.T) {
+	t.Parallel()
+	actual := ParseKeyValueTXT("trust=2; category=isp url=https://example.org/?ip=1.2.3.4 junk")
+	expected := map[string]string{
+		"trust":    "2",
+		"category": "isp",
+		"url":      "https://example.org/?ip=1.2.3.4",
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, actual %v", expected, actual)
+	}
+}
+
+func TestParseKeyValueTXTEmpty(t *testing.T) {
+	t.Parallel()
+	if actual := ParseKeyValueTXT(""); len(actual) != 0 {
+		t.Errorf("Expected no fields, actual %v", actual)
+	}
+}
+
+func TestFirstSeenField(t *testing.T) {
+	t.Parallel()
+	extract := FirstSeenField("first", time.RFC3339)
+
+	seen, ok := extract("first=2024-03-01T12:00:00Z; reason=spam")
+	if !ok || !seen.Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the first-seen time, actual %v (%t)", seen, ok)
+	}
+
+	if _, ok := extract("first=yesterday"); ok {
+		t.Errorf("Expected an unparseable time to be ignored")
+	}
+
+	if _, ok := extract("reason=spam"); ok {
+		t.Errorf("Expected a missing field to be ignored")
+	}
+}
+
+func TestNormalizeTXT(t *testing.T) {
+	t.Parallel()
+	cases := map[string][]string{
+		"Listed for spam":                     {"  Listed for spam \t"},
+		"Listed for spam see https://e.org/x": {" Listed for  spam", "see https://e.org/x "},
+		"":                                    {" ", ""},
+	}
+
+	for expected, txt := range cases {
+		if actual := NormalizeTXT(txt); actual != expected {
+			t.Errorf("Expected %q for %q, actual %q", expected, txt, actual)
+		}
+	}
+}
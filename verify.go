@@ -0,0 +1,91 @@
+package gorbl
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// DefaultSentinel is the test address (per RFC 5782) most DNSBLs list permanently.
+var DefaultSentinel = net.IPv4(127, 0, 0, 2)
+
+// DefaultControlName is the known-good name ResolverHealthy resolves unless configured otherwise (see WithControlName).
+const DefaultControlName = "example.com"
+
+/*
+Verify checks the RBL answers correctly on the current resolver by looking up its sentinel
+address (see WithSentinel), which should always be listed.
+
+Some lists (Spamhaus, for example) refuse queries from large public resolvers, answering
+NXDOMAIN for everything. If the sentinel isn't listed on every zone of the RBL, Verify returns
+false, indicating results from this list are unreliable on the current resolver. An error is
+returned if the sentinel lookup itself fails.
+*/
+func (r *RBL) Verify(ctx context.Context) (bool, error) {
+	sentinel := r.sentinel
+	if sentinel == nil {
+		sentinel = DefaultSentinel
+	}
+
+	// The sentinel is queried directly: it is loopback, so WithSkipUnqueryable (or an override) would otherwise answer it.
+	listed := map[string]bool{}
+	for _, res := range r.queryInput(ctx, sentinel.String()) {
+		if res.Error && !isNotFound(res.ErrorType) {
+			return false, res.ErrorType
+		}
+
+		if res.Listed {
+			listed[res.Zone] = true
+		}
+	}
+
+	for _, zone := range r.zones() {
+		if !listed[zone] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+/*
+Ping is a health check reporting whether the RBL is up: it returns nil if the sentinel
+address (see WithSentinel) is listed on every zone, ErrSentinelNotListed if the list answers
+without listing it, and the lookup's error if the list doesn't answer at all.
+*/
+func (r *RBL) Ping(ctx context.Context) error {
+	ok, err := r.Verify(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrSentinelNotListed
+	}
+
+	return nil
+}
+
+/*
+ResolverHealthy checks the RBL's resolver is reachable and answering by resolving a control
+name (DefaultControlName unless set using WithControlName), independently of the list itself.
+Calling it before a large scan fails fast when DNS is down, rather than producing an error
+Result for every query. The returned error wraps ErrResolverUnhealthy.
+*/
+func (r *RBL) ResolverHealthy(ctx context.Context) error {
+	name := r.controlName
+	if len(name) == 0 {
+		name = DefaultControlName
+	}
+
+	addrs, err := r.resolver.LookupIPAddr(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%w: resolving %s: %v", ErrResolverUnhealthy, name, err)
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("%w: no addresses for %s", ErrResolverUnhealthy, name)
+	}
+
+	return nil
+}
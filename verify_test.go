@@ -0,0 +1,127 @@
+package gorbl
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestVerifyListedSentinel(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	ok, err := rbl.Verify(context.Background())
+	if !ok || err != nil {
+		t.Errorf("Expected the list to verify, actual %t, %v", ok, err)
+	}
+}
+
+func TestVerifyBlockedResolver(t *testing.T) {
+	t.Parallel()
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(&mockResolver{}))
+
+	ok, err := rbl.Verify(context.Background())
+	if ok || err != nil {
+		t.Errorf("Expected the list to be reported unreliable without error, actual %t, %v", ok, err)
+	}
+}
+
+func TestVerifyCustomSentinel(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"4.0.0.127.dnsbl.example.org.": {"127.0.0.2"}},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithSentinel(net.IPv4(127, 0, 0, 4)))
+
+	if ok, _ := rbl.Verify(context.Background()); !ok {
+		t.Errorf("Expected the custom sentinel to be used")
+	}
+}
+
+func TestVerifyError(t *testing.T) {
+	t.Parallel()
+	failure := &net.DNSError{Err: "server misbehaving", Name: "2.0.0.127.dnsbl.example.org."}
+	mock := &mockResolver{
+		errs: map[string]error{"2.0.0.127.dnsbl.example.org.": failure},
+	}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock))
+
+	ok, err := rbl.Verify(context.Background())
+	if ok || !errors.Is(err, failure) {
+		t.Errorf("Expected the lookup error, actual %t, %v", ok, err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		hosts: map[string][]string{"2.0.0.127.up.example.org.": {"127.0.0.2"}, "1.2.0.192.test.example.org.": {"127.0.0.2"}},
+		errs:  map[string]error{"2.0.0.127.down.example.org.": &net.DNSError{Err: "i/o timeout", IsTimeout: true}},
+	}
+
+	if err := NewRBL("up.example.org", false, WithResolver(mock)).Ping(context.Background()); err != nil {
+		t.Errorf("Expected the list to be up, actual %v", err)
+	}
+
+	if err := NewRBL("test.example.org", false, WithResolver(mock), WithSentinel(net.IPv4(192, 0, 2, 1))).Ping(context.Background()); err != nil {
+		t.Errorf("Expected the configured test point to be used, actual %v", err)
+	}
+
+	if err := NewRBL("empty.example.org", false, WithResolver(mock)).Ping(context.Background()); !errors.Is(err, ErrSentinelNotListed) {
+		t.Errorf("Expected ErrSentinelNotListed, actual %v", err)
+	}
+
+	var dnsErr *net.DNSError
+	if err := NewRBL("down.example.org", false, WithResolver(mock)).Ping(context.Background()); !errors.As(err, &dnsErr) || !dnsErr.IsTimeout {
+		t.Errorf("Expected the lookup failure, actual %v", err)
+	}
+}
+
+func TestVerifySkipUnqueryable(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{hosts: map[string][]string{"2.0.0.127.dnsbl.example.org.": {"127.0.0.2"}}}
+	rbl := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithSkipUnqueryable())
+
+	if ok, err := rbl.Verify(context.Background()); !ok || err != nil {
+		t.Errorf("Expected the sentinel to be queried despite being loopback, actual %t, %v", ok, err)
+	}
+
+	if err := rbl.Ping(context.Background()); err != nil {
+		t.Errorf("Expected the list to be up, actual %v", err)
+	}
+
+	if c := mock.hostQueryCount(); c != 2 {
+		t.Errorf("Expected 2 sentinel queries, actual %d", c)
+	}
+
+	if res := rbl.LookupIP(context.Background(), net.ParseIP("127.0.0.2")); len(res.Results) != 1 || !res.Results[0].Skipped {
+		t.Errorf("Expected lookups of loopback IPs to still be skipped, actual %+v", res.Results)
+	}
+}
+
+func TestResolverHealthy(t *testing.T) {
+	t.Parallel()
+	mock := &mockResolver{
+		ips: map[string][]net.IPAddr{
+			"example.com":         {{IP: net.IPv4(192, 0, 2, 80)}},
+			"control.example.org": {{IP: net.IPv4(192, 0, 2, 53)}},
+		},
+	}
+
+	if err := NewRBL("dnsbl.example.org", false, WithResolver(mock)).ResolverHealthy(context.Background()); err != nil {
+		t.Errorf("Expected the resolver to be healthy, actual %v", err)
+	}
+
+	if err := NewRBL("dnsbl.example.org", false, WithResolver(mock), WithControlName("control.example.org")).ResolverHealthy(context.Background()); err != nil {
+		t.Errorf("Expected the configured control name to resolve, actual %v", err)
+	}
+
+	if err := NewRBL("dnsbl.example.org", false, WithResolver(&mockResolver{})).ResolverHealthy(context.Background()); !errors.Is(err, ErrResolverUnhealthy) {
+		t.Errorf("Expected ErrResolverUnhealthy, actual %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package gorbl
+
+/*
+CodeDecoder translates the address returned for a listing (i.e. 127.0.0.2) into the
+names of the sub-lists it represents. A nil or empty return indicates an unknown code.
+*/
+type CodeDecoder func(code string) []string
+
+// zenCodes maps the well-known Spamhaus zen return codes to the sub-list they originate from.
+var zenCodes = map[string][]string{
+	"127.0.0.2":  {"SBL"},
+	"127.0.0.3":  {"SBL", "CSS"},
+	"127.0.0.4":  {"XBL"},
+	"127.0.0.5":  {"XBL"},
+	"127.0.0.6":  {"XBL"},
+	"127.0.0.7":  {"XBL"},
+	"127.0.0.9":  {"SBL", "DROP"},
+	"127.0.0.10": {"PBL"},
+	"127.0.0.11": {"PBL"},
+}
+
+/*
+ZenDecoder decodes the return codes of the combined Spamhaus zen zone (zen.spamhaus.org)
+into the SBL, CSS, XBL, DROP and PBL sub-lists. Use it with WithCodeDecoder.
+*/
+func ZenDecoder(code string) []string {
+	names, ok := zenCodes[code]
+	if !ok {
+		return nil
+	}
+
+	return append([]string(nil), names...)
+}
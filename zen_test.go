@@ -0,0 +1,24 @@
+package gorbl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestZenDecoder(t *testing.T) {
+	t.Parallel()
+	cases := map[string][]string{
+		"127.0.0.2":  {"SBL"},
+		"127.0.0.3":  {"SBL", "CSS"},
+		"127.0.0.4":  {"XBL"},
+		"127.0.0.9":  {"SBL", "DROP"},
+		"127.0.0.11": {"PBL"},
+		"127.0.0.1":  nil,
+	}
+
+	for code, expected := range cases {
+		if actual := ZenDecoder(code); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v for %s, actual %v", expected, code, actual)
+		}
+	}
+}
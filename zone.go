@@ -0,0 +1,101 @@
+package gorbl
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/*
+ZoneInfo holds the SOA details of an RBL zone, which operators use to indicate how current
+the zone's data is.
+*/
+type ZoneInfo struct {
+	// Zone is the zone the SOA record belongs to
+	Zone string `json:"zone"`
+	// PrimaryNS is the primary nameserver of the zone
+	PrimaryNS string `json:"primary_ns"`
+	// Serial is the zone's serial number, typically increased whenever the data changes
+	Serial uint32 `json:"serial"`
+	// Refresh is how often secondary nameservers check for new data
+	Refresh time.Duration `json:"refresh"`
+	// Retry is how long secondaries wait before retrying a failed refresh
+	Retry time.Duration `json:"retry"`
+	// Expire is how long secondaries keep serving data without a successful refresh
+	Expire time.Duration `json:"expire"`
+}
+
+/*
+ZoneInfo queries the SOA record of the RBL's zone. It requires the RBL's resolver to be an
+Exchanger (such as a Client); ErrExchangerRequired is returned otherwise.
+*/
+func (r *RBL) ZoneInfo(ctx context.Context) (ZoneInfo, error) {
+	exchanger, ok := r.resolver.(Exchanger)
+	if !ok {
+		return ZoneInfo{}, ErrExchangerRequired
+	}
+
+	ctx, cancel := r.queryContext(ctx, 0)
+	defer cancel()
+
+	resp, err := exchanger.Exchange(ctx, fqdn(strings.TrimSuffix(r.hostname, ".")), dnsmessage.TypeSOA)
+	if err != nil {
+		return ZoneInfo{}, err
+	}
+
+	// The SOA is in the answer section at the zone apex, and in the authority section below it.
+	for _, section := range [][]dnsmessage.Resource{resp.Message.Answers, resp.Message.Authorities} {
+		for _, rr := range section {
+			soa, ok := rr.Body.(*dnsmessage.SOAResource)
+			if !ok {
+				continue
+			}
+
+			return ZoneInfo{
+				Zone:      rr.Header.Name.String(),
+				PrimaryNS: soa.NS.String(),
+				Serial:    soa.Serial,
+				Refresh:   time.Duration(soa.Refresh) * time.Second,
+				Retry:     time.Duration(soa.Retry) * time.Second,
+				Expire:    time.Duration(soa.Expire) * time.Second,
+			}, nil
+		}
+	}
+
+	return ZoneInfo{}, errors.New("gorbl: no SOA record returned for " + r.hostname)
+}
+
+/*
+ZoneExists returns true if the RBL's zone exists, catching misconfigured (i.e. mistyped)
+hostnames that would otherwise report NXDOMAIN, and so not listed, for every query. The
+zone's SOA record is queried: a name error (NXDOMAIN) reports the zone doesn't exist, while
+any other answer reports it does, including for lists served from a name within their
+parent zone rather than a delegated zone of their own. Failed queries return their error.
+
+Like ZoneInfo it requires the RBL's resolver to be an Exchanger (such as a Client), as
+net.Resolver doesn't distinguish a missing name from one without SOA records;
+ErrExchangerRequired is returned otherwise.
+*/
+func (r *RBL) ZoneExists(ctx context.Context) (bool, error) {
+	exchanger, ok := r.resolver.(Exchanger)
+	if !ok {
+		return false, ErrExchangerRequired
+	}
+
+	ctx, cancel := r.queryContext(ctx, 0)
+	defer cancel()
+
+	resp, err := exchanger.Exchange(ctx, fqdn(strings.TrimSuffix(r.hostname, ".")), dnsmessage.TypeSOA)
+	if resp != nil && resp.Message.Header.RCode == dnsmessage.RCodeNameError {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,93 @@
+package gorbl
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// soaHandler answers SOA queries for zone, in the answer section at the apex and the authority section below it.
+func soaHandler(zone string, serial uint32) testHandler {
+	return func(q dnsmessage.Message) dnsmessage.Message {
+		question := q.Questions[0]
+		apex := dnsmessage.MustNewName(zone)
+
+		rr := dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: apex, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET},
+			Body: &dnsmessage.SOAResource{
+				NS:      dnsmessage.MustNewName("ns1." + zone),
+				MBox:    dnsmessage.MustNewName("hostmaster." + zone),
+				Serial:  serial,
+				Refresh: 600,
+				Retry:   60,
+				Expire:  86400,
+				MinTTL:  60,
+			},
+		}
+
+		if question.Type == dnsmessage.TypeSOA && question.Name.String() == zone {
+			return dnsmessage.Message{Answers: []dnsmessage.Resource{rr}}
+		}
+
+		return dnsmessage.Message{Authorities: []dnsmessage.Resource{rr}}
+	}
+}
+
+func TestZoneInfo(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, soaHandler("example.org.", 2024010203))
+
+	for _, hostname := range []string{"example.org", "dnsbl.example.org"} {
+		info, err := NewRBL(hostname, false, WithResolver(NewClient(server))).ZoneInfo(context.Background())
+		if err != nil {
+			t.Fatalf("Expected zone info for %s, actual %v", hostname, err)
+		}
+
+		if info.Serial != 2024010203 || info.Refresh != time.Minute*10 || info.PrimaryNS != "ns1.example.org." {
+			t.Errorf("Expected the SOA details for %s, actual %+v", hostname, info)
+		}
+	}
+}
+
+func TestZoneInfoRequiresExchanger(t *testing.T) {
+	t.Parallel()
+	if _, err := NewRBL("example.org", false, WithResolver(&mockResolver{})).ZoneInfo(context.Background()); err != ErrExchangerRequired {
+		t.Errorf("Expected ErrExchangerRequired, actual %v", err)
+	}
+}
+
+func TestZoneExists(t *testing.T) {
+	t.Parallel()
+	soa := soaHandler("example.org.", 2024010203)
+	server := startTestServer(t, func(q dnsmessage.Message) dnsmessage.Message {
+		switch q.Questions[0].Name.String() {
+		case "example.org.", "dnsbl.example.org.":
+			return soa(q)
+		case "broken.example.org.":
+			return dnsmessage.Message{Header: dnsmessage.Header{RCode: dnsmessage.RCodeServerFailure}}
+		}
+
+		return dnsmessage.Message{Header: dnsmessage.Header{RCode: dnsmessage.RCodeNameError}}
+	})
+
+	for hostname, expected := range map[string]bool{"example.org": true, "dnsbl.example.org": true, "dnsbl.exmaple.org": false} {
+		exists, err := NewRBL(hostname, false, WithResolver(NewClient(server))).ZoneExists(context.Background())
+		if err != nil {
+			t.Errorf("Expected no error for %s, actual %v", hostname, err)
+		}
+
+		if exists != expected {
+			t.Errorf("Expected %s to exist %t, actual %t", hostname, expected, exists)
+		}
+	}
+
+	if _, err := NewRBL("broken.example.org", false, WithResolver(NewClient(server))).ZoneExists(context.Background()); err == nil {
+		t.Errorf("Expected the failed query to be reported")
+	}
+
+	if _, err := NewRBL("example.org", false, WithResolver(&mockResolver{})).ZoneExists(context.Background()); err != ErrExchangerRequired {
+		t.Errorf("Expected ErrExchangerRequired, actual %v", err)
+	}
+}